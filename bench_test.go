@@ -0,0 +1,238 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The legacy router below is the map and pool based implementation replaced by the radix tree,
+// it is kept here only as the baseline of the benchmarks.
+
+type legacyRouter struct {
+	key         string
+	middlewares []func(*legacyContext) error
+	children    map[string]*legacyRouter
+	handlers    map[string][]func(*legacyContext) error
+}
+
+type legacyContext struct {
+	Request        *http.Request
+	ResponseWriter http.ResponseWriter
+	Path           string
+
+	datas  map[string]interface{}
+	params map[string]string
+	router *legacyRouter
+	index  int
+}
+
+var legacyPool = &sync.Pool{
+	New: func() interface{} {
+		return new(legacyContext)
+	},
+}
+
+func newLegacyRouter() *legacyRouter {
+	return &legacyRouter{
+		children: make(map[string]*legacyRouter),
+		handlers: make(map[string][]func(*legacyContext) error),
+	}
+}
+
+func (a *legacyRouter) route(pattern string) *legacyRouter {
+	pattern = pattern[1:]
+	i := strings.IndexByte(pattern, '/')
+	key := pattern
+	if i >= 0 {
+		key = pattern[:i]
+	}
+	router, ok := a.children[key]
+	if !ok {
+		router = newLegacyRouter()
+		if len(key) > 0 && key[0] == ':' {
+			a.key = key
+		}
+		a.children[key] = router
+	}
+	if i < 0 {
+		return router
+	}
+	return router.route(pattern[i:])
+}
+
+func (a *legacyRouter) match(path string) (*legacyRouter, string, string) {
+	path = path[1:]
+	i := strings.IndexByte(path, '/')
+	var key, param string
+	if i < 0 {
+		key, path = path, ""
+	} else {
+		key, path = path[:i], path[i:]
+	}
+	if a.key != "" {
+		key, param = a.key, key
+	}
+	return a.children[key], path, param
+}
+
+func (a *legacyRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := legacyPool.Get().(*legacyContext)
+	defer legacyPool.Put(ctx)
+	ctx.Request = r
+	ctx.ResponseWriter = w
+	ctx.Path = r.URL.Path
+	ctx.datas = make(map[string]interface{})
+	ctx.params = make(map[string]string)
+	ctx.router = a
+	ctx.index = -len(a.middlewares)
+	ctx.Next()
+}
+
+func (a *legacyContext) Next() error {
+	ctx := legacyPool.Get().(*legacyContext)
+	defer legacyPool.Put(ctx)
+	*ctx = *a
+	ctx.index = a.index + 1
+
+	if a.index < 0 {
+		ms := a.router.middlewares
+		return ms[a.index+len(ms)](ctx)
+	}
+	if a.Path == "" {
+		hs, ok := a.router.handlers[a.Request.Method]
+		if !ok {
+			return Status(http.StatusMethodNotAllowed, "")
+		}
+		if a.index < len(hs) {
+			return hs[a.index](ctx)
+		}
+		return nil
+	}
+
+	router, path, param := a.router.match(a.Path)
+	if router == nil {
+		return Status(http.StatusNotFound, "")
+	}
+	if key := a.router.key; key != "" {
+		a.params[key[1:]] = param
+	}
+	ctx.Path = path
+	ctx.router = router
+	ctx.index = -len(router.middlewares)
+	return ctx.Next()
+}
+
+var benchPatterns = []string{
+	"/users", "/users/:id", "/users/:id/posts", "/users/:id/posts/:pid",
+	"/orgs", "/orgs/:id", "/orgs/:id/members", "/repos/:owner/:repo", "/repos/:owner/:repo/issues/:id",
+}
+
+func benchRadix() http.Handler {
+	s := New()
+	h := func(ctx *Context) error {
+		_ = ctx.Param("id")
+		return nil
+	}
+	mw := func(ctx *Context) error {
+		return ctx.Next()
+	}
+	s.Use(mw)
+	api := s.Route("/api/v1").Use(mw)
+	for _, p := range benchPatterns {
+		api.Get(p, h)
+		api.Post(p, h)
+	}
+	api.Get("/files/*path", h)
+	s.Get("/", h)
+	s.Get("/about", h)
+	return s
+}
+
+func benchLegacy() http.Handler {
+	s := newLegacyRouter()
+	h := func(ctx *legacyContext) error {
+		_ = ctx.params["id"]
+		return nil
+	}
+	mw := func(ctx *legacyContext) error {
+		return ctx.Next()
+	}
+	s.middlewares = append(s.middlewares, mw)
+	api := s.route("/api").route("/v1")
+	api.middlewares = append(api.middlewares, mw)
+	for _, p := range benchPatterns {
+		r := api.route(p)
+		r.handlers[http.MethodGet] = append(r.handlers[http.MethodGet], h)
+		r.handlers[http.MethodPost] = append(r.handlers[http.MethodPost], h)
+	}
+	r := s.route("/about")
+	r.handlers[http.MethodGet] = append(r.handlers[http.MethodGet], h)
+	return s
+}
+
+type discardWriter struct {
+	header http.Header
+}
+
+func (a *discardWriter) Header() http.Header {
+	return a.header
+}
+
+func (a *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (a *discardWriter) WriteHeader(int) {}
+
+func benchServe(b *testing.B, h http.Handler, path string) {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	w := &discardWriter{header: make(http.Header)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkRouter(b *testing.B) {
+	routers := []struct {
+		name string
+		h    http.Handler
+	}{
+		{"radix", benchRadix()},
+		{"legacy", benchLegacy()},
+	}
+	paths := []struct {
+		name string
+		path string
+	}{
+		{"static", "/about"},
+		{"param", "/api/v1/users/42/posts/7"},
+		{"deep", "/api/v1/repos/ofunc/ws/issues/1"},
+	}
+	for _, p := range paths {
+		for _, r := range routers {
+			b.Run(p.name+"/"+r.name, func(b *testing.B) {
+				benchServe(b, r.h, p.path)
+			})
+		}
+	}
+	b.Run("wildcard/radix", func(b *testing.B) {
+		benchServe(b, routers[0].h, "/api/v1/files/a/b/c.txt")
+	})
+}
+
+func TestRouterZeroAllocs(t *testing.T) {
+	h := benchRadix()
+	for _, path := range []string{"/about", "/api/v1/users/42/posts/7", "/api/v1/files/a/b/c.txt"} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		w := &discardWriter{header: make(http.Header)}
+		h.ServeHTTP(w, r)
+		if n := testing.AllocsPerRun(100, func() { h.ServeHTTP(w, r) }); n != 0 {
+			t.Errorf("GET %s allocates %v times", path, n)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package ws
+
+import (
+	"encoding"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Bind binds the request to dst, which must be a pointer to struct.
+// The body is decoded by the codec of Content-Type at first, then the fields tagged with
+// path, query, header or form are set from the params, query, header and form values.
+// It returns a 400 StatusError which lists every field failed,
+// and the bound struct is validated by Validate at last.
+func (a *Context) Bind(dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("ws: bind to non struct pointer")
+	}
+	if err := a.bindBody(dst); err != nil {
+		return err
+	}
+
+	var errs []string
+	a.bindStruct(rv.Elem(), &errs)
+	if len(errs) > 0 {
+		msg := strings.Join(errs, "; ")
+		return Status(http.StatusBadRequest, "bind: "+msg).Message(msg)
+	}
+	return Validate(dst)
+}
+
+// bindBody decodes the body by Content-Type.
+func (a *Context) bindBody(dst interface{}) error {
+	r := a.Request
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return nil
+	}
+
+	ct := r.Header.Get("Content-Type")
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return Status(http.StatusUnsupportedMediaType, ct).Wrap(err)
+	}
+	switch mt {
+	case "application/x-www-form-urlencoded":
+		err = r.ParseForm()
+	case "multipart/form-data":
+		err = r.ParseMultipartForm(32 << 20)
+	default:
+		return a.decode(mt, dst)
+	}
+	if err != nil {
+		return a.bodyError(err)
+	}
+	return nil
+}
+
+// bindStruct sets the tagged fields of the struct, and appends the failures to errs.
+func (a *Context) bindStruct(v reflect.Value, errs *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		found := false
+		for _, src := range [...]string{"path", "query", "header", "form"} {
+			key, ok := f.Tag.Lookup(src)
+			if !ok || key == "" || key == "-" {
+				continue
+			}
+			found = true
+			values := a.bindValues(src, key)
+			if len(values) == 0 {
+				continue
+			}
+			if err := setValues(fv, values); err != nil {
+				*errs = append(*errs, src+" "+strconv.Quote(key)+": "+err.Error())
+			}
+		}
+		if !found && f.Anonymous && fv.Kind() == reflect.Struct {
+			a.bindStruct(fv, errs)
+		}
+	}
+}
+
+// bindValues returns the values of key from the source.
+func (a *Context) bindValues(src, key string) []string {
+	switch src {
+	case "path":
+		if v, ok := a.param(key); ok {
+			return []string{v}
+		}
+	case "query":
+		if a.querys == nil {
+			a.querys, _ = url.ParseQuery(a.Request.URL.RawQuery)
+		}
+		return a.querys[key]
+	case "header":
+		return a.Request.Header[http.CanonicalHeaderKey(key)]
+	case "form":
+		return a.Request.PostForm[key]
+	}
+	return nil
+}
+
+// setValues sets the values to v, slices receive all the values and others receive the first.
+func setValues(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 && !v.Addr().Type().Implements(textUnmarshalerType) {
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(s.Index(i), value); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setValue(v, values[0])
+}
+
+// setValue converts the value and sets it to v.
+func setValue(v reflect.Value, value string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setValue(v.Elem(), value)
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return numError(err)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return numError(err)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return numError(err)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return numError(err)
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return errors.New("unsupported type " + v.Type().String())
+		}
+		v.SetBytes([]byte(value))
+	default:
+		return errors.New("unsupported type " + v.Type().String())
+	}
+	return nil
+}
+
+// numError returns the short error of strconv.
+func numError(err error) error {
+	if e, ok := err.(*strconv.NumError); ok {
+		return errors.New(e.Err.Error() + " " + strconv.Quote(e.Num))
+	}
+	return err
+}
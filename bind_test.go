@@ -0,0 +1,50 @@
+package ws
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindRequest struct {
+	ID      int           `path:"id"`
+	Page    int           `query:"page"`
+	Tags    []string      `query:"tag"`
+	Timeout time.Duration `query:"timeout"`
+	Token   string        `header:"X-Token"`
+	Name    string        `json:"name" validate:"required"`
+	Note    string        `form:"note"`
+}
+
+func TestBind(t *testing.T) {
+	var got bindRequest
+	s := New()
+	s.Post("/items/:id", func(ctx *Context) error {
+		got = bindRequest{}
+		return ctx.Bind(&got)
+	})
+
+	w := serve(s, http.MethodPost, "/items/7?page=2&tag=a&tag=b&timeout=1s", strings.NewReader(`{"name":"x"}`),
+		"Content-Type", "application/json", "X-Token", "t")
+	want := bindRequest{ID: 7, Page: 2, Tags: []string{"a", "b"}, Timeout: time.Second, Token: "t", Name: "x"}
+	if w.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+		t.Errorf("Bind = %d %+v, want %+v", w.Code, got, want)
+	}
+
+	w = serve(s, http.MethodPost, "/items/7", strings.NewReader("note=hi&name=x"), "Content-Type", "application/x-www-form-urlencoded")
+	if w.Code != http.StatusUnprocessableEntity || got.Note != "hi" {
+		t.Errorf("Bind form = %d %+v, want 422 with note", w.Code, got)
+	}
+
+	w = serve(s, http.MethodPost, "/items/x?page=y", strings.NewReader(`{"name":"x"}`), "Content-Type", "application/json")
+	if body := w.Body.String(); w.Code != http.StatusBadRequest || !strings.Contains(body, `path "id"`) || !strings.Contains(body, `query "page"`) {
+		t.Errorf("Bind invalid = %d %q, want 400 listing both fields", w.Code, body)
+	}
+
+	w = serve(s, http.MethodPost, "/items/1", strings.NewReader(`{}`), "Content-Type", "application/octet-stream")
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Bind unknown type = %d, want 415", w.Code)
+	}
+}
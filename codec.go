@@ -0,0 +1,224 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Codec encodes and decodes the values of a media type.
+type Codec interface {
+	Encode(w io.Writer, value interface{}) error
+	Decode(r io.Reader, value interface{}, opts DecodeOptions) error
+}
+
+type codecEntry struct {
+	mediaType string
+	codec     Codec
+}
+
+var codecs = []codecEntry{
+	{"application/json", jsonCodec{}},
+	{"application/xml", xmlCodec{}},
+	{"text/plain", textCodec{}},
+	{"text/csv", csvCodec{}},
+	{"application/x-www-form-urlencoded", formCodec{}},
+	{"application/msgpack", msgpackCodec{}},
+	{"application/cbor", cborCodec{}},
+}
+
+// RegisterCodec registers the codec of the media type, it replaces the registered one.
+// The earlier registered media type is preferred by Render if the client accepts them equally.
+// It is not safe to call concurrently with the requests.
+func RegisterCodec(mediaType string, c Codec) {
+	mediaType = strings.ToLower(mediaType)
+	for i, e := range codecs {
+		if e.mediaType == mediaType {
+			codecs[i].codec = c
+			return
+		}
+	}
+	codecs = append(codecs, codecEntry{mediaType, c})
+}
+
+// Encoder encodes the value to w.
+type Encoder func(w io.Writer, value interface{}) error
+
+// RegisterEncoder registers the encoder of the media type for Render and Encode, it replaces the registered codec.
+// The request bodies of the media type are rejected by 415.
+func RegisterEncoder(mediaType string, enc Encoder) {
+	RegisterCodec(mediaType, encoderCodec{enc})
+}
+
+// encoderCodec is the codec registered by RegisterEncoder, which does not decode.
+type encoderCodec struct {
+	encode Encoder
+}
+
+func (a encoderCodec) Encode(w io.Writer, value interface{}) error {
+	return a.encode(w, value)
+}
+
+func (a encoderCodec) Decode(r io.Reader, value interface{}, opts DecodeOptions) error {
+	return errors.New("ws: no decoder")
+}
+
+// lookupCodec returns the codec of the media type, the structured syntax suffixes
+// such as +json and +xml fall back to the codecs of application/json and application/xml.
+func lookupCodec(mediaType string) Codec {
+	mediaType = strings.ToLower(mediaType)
+	for _, e := range codecs {
+		if e.mediaType == mediaType {
+			return e.codec
+		}
+	}
+	family := mediaFamily(mediaType)
+	for _, e := range codecs {
+		if e.mediaType == family {
+			return e.codec
+		}
+	}
+	return nil
+}
+
+// mediaFamily returns the base media type of the structured syntax suffixes.
+func mediaFamily(mediaType string) string {
+	switch {
+	case strings.HasSuffix(mediaType, "+json"):
+		return "application/json"
+	case mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return "application/xml"
+	case mediaType == "application/x-msgpack":
+		return "application/msgpack"
+	default:
+		return mediaType
+	}
+}
+
+// contentType returns the Content-Type header of the media type.
+func contentType(mediaType string) string {
+	if strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "json") || strings.HasSuffix(mediaType, "xml") {
+		return mediaType + "; charset=utf-8"
+	}
+	return mediaType
+}
+
+// Encode responses the value encoded by the codec of the media type.
+func (a *Context) Encode(mediaType string, value interface{}) error {
+	c := lookupCodec(mediaType)
+	if c == nil {
+		return errors.New("ws: no codec for " + mediaType)
+	}
+	var buf bytes.Buffer
+	if err := c.Encode(&buf, value); err != nil {
+		return err
+	}
+	a.write(mediaType, buf.Bytes())
+	return nil
+}
+
+// write responses the encoded body with the status code.
+func (a *Context) write(mediaType string, body []byte) {
+	a.ResponseWriter.Header().Set("Content-Type", contentType(mediaType))
+	a.ResponseWriter.WriteHeader(a.statusCode())
+	a.ResponseWriter.Write(body)
+}
+
+// Parse parses the body by the codec of its Content-Type and the decode options of the router.
+// It returns a 415 StatusError if there is no codec for the Content-Type.
+func (a *Context) Parse(value interface{}) error {
+	ct := a.Request.Header.Get("Content-Type")
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return Status(http.StatusUnsupportedMediaType, ct).Wrap(err)
+	}
+	return a.decode(mt, value)
+}
+
+// decode parses the body by the codec of the media type.
+func (a *Context) decode(mediaType string, value interface{}) error {
+	c := lookupCodec(mediaType)
+	if _, ok := c.(encoderCodec); c == nil || ok {
+		return Status(http.StatusUnsupportedMediaType, mediaType)
+	}
+	opts := a.decodeOptions()
+	if err := a.checkContentType(opts, mediaType); err != nil {
+		return err
+	}
+	if err := c.Decode(a.Request.Body, value, opts); err != nil {
+		return a.bodyError(err)
+	}
+	return nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(w io.Writer, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (jsonCodec) Decode(r io.Reader, value interface{}, opts DecodeOptions) error {
+	return decodeJSON(r, opts, value)
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) Encode(w io.Writer, value interface{}) error {
+	b, err := xml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (xmlCodec) Decode(r io.Reader, value interface{}, opts DecodeOptions) error {
+	return decodeXML(r, opts, value)
+}
+
+type structField struct {
+	name  string
+	index []int
+}
+
+// fieldsOf returns the exported fields of the struct type, which are named by the tag,
+// the json tag or the field name in order. The fields of embedded structs are flattened.
+func fieldsOf(t reflect.Type, tag string) []structField {
+	var fs []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get(tag), ",")[0]
+		if name == "" {
+			name = strings.Split(f.Tag.Get("json"), ",")[0]
+		}
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for _, sf := range fieldsOf(f.Type, tag) {
+				sf.index = append([]int{i}, sf.index...)
+				fs = append(fs, sf)
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fs = append(fs, structField{name, []int{i}})
+	}
+	return fs
+}
@@ -0,0 +1,382 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// maxDepth is the max nesting depth of the binary data items.
+const maxDepth = 512
+
+var errTooDeep = errors.New("ws: data items nested too deep")
+
+// binaryWriter writes the data items of a binary format like MessagePack or CBOR.
+type binaryWriter interface {
+	writeNil()
+	writeBool(b bool)
+	writeInt(i int64)
+	writeUint(u uint64)
+	writeFloat(f float64, bits int)
+	writeString(s string)
+	writeBytes(b []byte)
+	writeArray(n int)
+	writeMap(n int)
+}
+
+// encodeBinary writes v by w, the structs are written as maps whose keys are named by the tag.
+func encodeBinary(w binaryWriter, v reflect.Value, tag string, depth int) error {
+	if depth > maxDepth {
+		return errTooDeep
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		w.writeNil()
+		return nil
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		if err != nil {
+			return err
+		}
+		w.writeString(string(b))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		w.writeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		w.writeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		w.writeFloat(v.Float(), v.Type().Bits())
+	case reflect.String:
+		w.writeString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			w.writeBytes(b)
+			return nil
+		}
+		w.writeArray(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeBinary(w, v.Index(i), tag, depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		keys := v.MapKeys()
+		if v.Type().Key().Kind() == reflect.String {
+			sort.Slice(keys, func(i, j int) bool {
+				return keys[i].String() < keys[j].String()
+			})
+		}
+		w.writeMap(len(keys))
+		for _, k := range keys {
+			if err := encodeBinary(w, k, tag, depth+1); err != nil {
+				return err
+			}
+			if err := encodeBinary(w, v.MapIndex(k), tag, depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fs := fieldsOf(v.Type(), tag)
+		w.writeMap(len(fs))
+		for _, f := range fs {
+			w.writeString(f.name)
+			if err := encodeBinary(w, v.FieldByIndex(f.index), tag, depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New("ws: unsupported type " + v.Type().String())
+	}
+	return nil
+}
+
+// readBytes reads n bytes, the buffer grows with the data read instead of n.
+func readBytes(r *bufio.Reader, n uint64) ([]byte, error) {
+	if n > math.MaxInt32 {
+		return nil, errors.New("ws: data item too large")
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// capacity returns the initial capacity for n items which may be forged.
+func capacity(n uint64) int {
+	if n > 1024 {
+		return 1024
+	}
+	return int(n)
+}
+
+// mapKey converts the decoded key to a comparable map key.
+func mapKey(k interface{}) (interface{}, error) {
+	switch x := k.(type) {
+	case []byte:
+		return string(x), nil
+	case []interface{}, map[string]interface{}, map[interface{}]interface{}:
+		return nil, errors.New("ws: unsupported map key type " + fmt.Sprintf("%T", k))
+	default:
+		return k, nil
+	}
+}
+
+// newMap returns the decoded map, which is map[string]interface{} if all keys are strings.
+func newMap(keys, values []interface{}) interface{} {
+	strs := true
+	for _, k := range keys {
+		if _, ok := k.(string); !ok {
+			strs = false
+			break
+		}
+	}
+	if strs {
+		m := make(map[string]interface{}, len(keys))
+		for i, k := range keys {
+			m[k.(string)] = values[i]
+		}
+		return m
+	}
+	m := make(map[interface{}]interface{}, len(keys))
+	for i, k := range keys {
+		m[k] = values[i]
+	}
+	return m
+}
+
+// checkEOF returns an error if there is trailing data.
+func checkEOF(r *bufio.Reader) error {
+	if _, err := r.ReadByte(); err != io.EOF {
+		if err == nil {
+			err = errors.New("ws: trailing data after the data item")
+		}
+		return err
+	}
+	return nil
+}
+
+// assignValue assigns the decoded x to the value which must be a non-nil pointer.
+func assignValue(value interface{}, x interface{}, tag string, opts DecodeOptions) error {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("ws: decode into non pointer")
+	}
+	return assign(v.Elem(), x, tag, opts)
+}
+
+// assign assigns the decoded x to the addressable v, the struct fields are named by the tag.
+func assign(v reflect.Value, x interface{}, tag string, opts DecodeOptions) error {
+	if x == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		v.Set(reflect.ValueOf(x))
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assign(v.Elem(), x, tag, opts)
+	}
+	if xv := reflect.ValueOf(x); xv.Type() == v.Type() {
+		v.Set(xv)
+		return nil
+	}
+	if s, ok := x.(string); ok {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(s))
+		}
+	}
+
+	mismatch := fmt.Errorf("ws: cannot decode %T into %s", x, v.Type())
+	switch v.Kind() {
+	case reflect.Bool:
+		b, ok := x.(bool)
+		if !ok {
+			return mismatch
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch x := x.(type) {
+		case int64:
+			n = x
+		case uint64:
+			if x > math.MaxInt64 {
+				return mismatch
+			}
+			n = int64(x)
+		default:
+			return mismatch
+		}
+		if v.OverflowInt(n) {
+			return mismatch
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		switch x := x.(type) {
+		case int64:
+			if x < 0 {
+				return mismatch
+			}
+			n = uint64(x)
+		case uint64:
+			n = x
+		default:
+			return mismatch
+		}
+		if v.OverflowUint(n) {
+			return mismatch
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		switch x := x.(type) {
+		case float64:
+			v.SetFloat(x)
+		case int64:
+			v.SetFloat(float64(x))
+		case uint64:
+			v.SetFloat(float64(x))
+		default:
+			return mismatch
+		}
+	case reflect.String:
+		switch x := x.(type) {
+		case string:
+			v.SetString(x)
+		case []byte:
+			v.SetString(string(x))
+		default:
+			return mismatch
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			switch x := x.(type) {
+			case []byte:
+				v.SetBytes(x)
+				return nil
+			case string:
+				v.SetBytes([]byte(x))
+				return nil
+			}
+		}
+		xs, ok := x.([]interface{})
+		if !ok {
+			return mismatch
+		}
+		s := reflect.MakeSlice(v.Type(), len(xs), len(xs))
+		for i, e := range xs {
+			if err := assign(s.Index(i), e, tag, opts); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Array:
+		if b, ok := x.([]byte); ok && v.Type().Elem().Kind() == reflect.Uint8 && len(b) <= v.Len() {
+			reflect.Copy(v, reflect.ValueOf(b))
+			return nil
+		}
+		xs, ok := x.([]interface{})
+		if !ok || len(xs) > v.Len() {
+			return mismatch
+		}
+		for i, e := range xs {
+			if err := assign(v.Index(i), e, tag, opts); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		err := eachEntry(x, func(k, e interface{}) error {
+			kv := reflect.New(v.Type().Key()).Elem()
+			if err := assign(kv, k, tag, opts); err != nil {
+				return err
+			}
+			ev := reflect.New(v.Type().Elem()).Elem()
+			if err := assign(ev, e, tag, opts); err != nil {
+				return err
+			}
+			m.SetMapIndex(kv, ev)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		v.Set(m)
+	case reflect.Struct:
+		fields := make(map[string][]int)
+		for _, f := range fieldsOf(v.Type(), tag) {
+			fields[f.name] = f.index
+		}
+		return eachEntry(x, func(k, e interface{}) error {
+			name, _ := k.(string)
+			index, ok := fields[name]
+			if !ok {
+				if opts.DisallowUnknownFields {
+					return fmt.Errorf("ws: unknown field %v", k)
+				}
+				return nil
+			}
+			return assign(v.FieldByIndex(index), e, tag, opts)
+		})
+	default:
+		return mismatch
+	}
+	return nil
+}
+
+// eachEntry calls fn for every entry of the decoded map x.
+func eachEntry(x interface{}, fn func(k, e interface{}) error) error {
+	switch m := x.(type) {
+	case map[string]interface{}:
+		for k, e := range m {
+			if err := fn(k, e); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		for k, e := range m {
+			if err := fn(k, e); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("ws: cannot decode %T into map or struct", x)
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package ws
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// cborCodec encodes and decodes the values as CBOR, the struct fields are named by the cbor tags.
+// The date/time tags are decoded into time.Time, and time.Time is encoded as RFC 3339 string.
+type cborCodec struct{}
+
+func (cborCodec) Encode(w io.Writer, value interface{}) error {
+	bw := bufio.NewWriter(w)
+	if err := encodeBinary(cborWriter{bw}, reflect.ValueOf(value), "cbor", 0); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func (cborCodec) Decode(r io.Reader, value interface{}, opts DecodeOptions) error {
+	br := bufio.NewReader(r)
+	x, err := readCBOR(br, 0)
+	if err != nil {
+		return err
+	}
+	if x == cborBreak {
+		return errCBORBreak
+	}
+	if opts.DisallowTrailingData {
+		if err := checkEOF(br); err != nil {
+			return err
+		}
+	}
+	return assignValue(value, x, "cbor", opts)
+}
+
+type cborWriter struct {
+	w *bufio.Writer
+}
+
+func (a cborWriter) head(major byte, n uint64) {
+	var buf [9]byte
+	switch {
+	case n < 24:
+		a.w.WriteByte(major<<5 | byte(n))
+		return
+	case n <= math.MaxUint8:
+		buf[0], buf[1] = major<<5|24, byte(n)
+		a.w.Write(buf[:2])
+	case n <= math.MaxUint16:
+		buf[0] = major<<5 | 25
+		binary.BigEndian.PutUint16(buf[1:], uint16(n))
+		a.w.Write(buf[:3])
+	case n <= math.MaxUint32:
+		buf[0] = major<<5 | 26
+		binary.BigEndian.PutUint32(buf[1:], uint32(n))
+		a.w.Write(buf[:5])
+	default:
+		buf[0] = major<<5 | 27
+		binary.BigEndian.PutUint64(buf[1:], n)
+		a.w.Write(buf[:9])
+	}
+}
+
+func (a cborWriter) writeNil() {
+	a.w.WriteByte(0xf6)
+}
+
+func (a cborWriter) writeBool(b bool) {
+	if b {
+		a.w.WriteByte(0xf5)
+	} else {
+		a.w.WriteByte(0xf4)
+	}
+}
+
+func (a cborWriter) writeInt(i int64) {
+	if i >= 0 {
+		a.head(0, uint64(i))
+	} else {
+		a.head(1, uint64(-1-i))
+	}
+}
+
+func (a cborWriter) writeUint(u uint64) {
+	a.head(0, u)
+}
+
+func (a cborWriter) writeFloat(f float64, bits int) {
+	var buf [9]byte
+	if bits == 32 {
+		buf[0] = 0xfa
+		binary.BigEndian.PutUint32(buf[1:], math.Float32bits(float32(f)))
+		a.w.Write(buf[:5])
+	} else {
+		buf[0] = 0xfb
+		binary.BigEndian.PutUint64(buf[1:], math.Float64bits(f))
+		a.w.Write(buf[:9])
+	}
+}
+
+func (a cborWriter) writeString(s string) {
+	a.head(3, uint64(len(s)))
+	a.w.WriteString(s)
+}
+
+func (a cborWriter) writeBytes(b []byte) {
+	a.head(2, uint64(len(b)))
+	a.w.Write(b)
+}
+
+func (a cborWriter) writeArray(n int) {
+	a.head(4, uint64(n))
+}
+
+func (a cborWriter) writeMap(n int) {
+	a.head(5, uint64(n))
+}
+
+type cborBreakType struct{}
+
+// cborBreak is returned by readCBOR for the break stop code of the indefinite length items.
+var cborBreak = cborBreakType{}
+
+var errCBORBreak = errors.New("ws: unexpected CBOR break")
+
+// indefinite is the argument of the indefinite length items.
+const indefinite = math.MaxUint64
+
+// readCBOR reads a CBOR data item into the generic value.
+func readCBOR(r *bufio.Reader, depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errTooDeep
+	}
+	b, err := r.ReadByte()
+	if err != nil {
+		if err == io.EOF && depth > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if b == 0xff {
+		return cborBreak, nil
+	}
+
+	major, info := b>>5, b&0x1f
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		if n, err = readUint(r, 1<<(info-24)); err != nil {
+			return nil, err
+		}
+	case info == 31 && major >= 2 && major <= 5:
+		n = indefinite
+	default:
+		return nil, errors.New("ws: invalid CBOR byte 0x" + strconv.FormatUint(uint64(b), 16))
+	}
+
+	switch major {
+	case 0:
+		if n <= math.MaxInt64 {
+			return int64(n), nil
+		}
+		return n, nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, errors.New("ws: CBOR negative integer overflows int64")
+		}
+		return -1 - int64(n), nil
+	case 2, 3:
+		s, err := readCBORString(r, major, n)
+		if err != nil {
+			return nil, err
+		}
+		if major == 3 {
+			return string(s), nil
+		}
+		return s, nil
+	case 4:
+		xs := make([]interface{}, 0, capacity(n))
+		for i := uint64(0); n == indefinite || i < n; i++ {
+			x, err := readCBOR(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if x == cborBreak {
+				if n != indefinite {
+					return nil, errCBORBreak
+				}
+				break
+			}
+			xs = append(xs, x)
+		}
+		return xs, nil
+	case 5:
+		keys := make([]interface{}, 0, capacity(n))
+		values := make([]interface{}, 0, capacity(n))
+		for i := uint64(0); n == indefinite || i < n; i++ {
+			k, err := readCBOR(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if k == cborBreak {
+				if n != indefinite {
+					return nil, errCBORBreak
+				}
+				break
+			}
+			if k, err = mapKey(k); err != nil {
+				return nil, err
+			}
+			x, err := readCBOR(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if x == cborBreak {
+				return nil, errCBORBreak
+			}
+			keys = append(keys, k)
+			values = append(values, x)
+		}
+		return newMap(keys, values), nil
+	case 6:
+		x, err := readCBOR(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if x == cborBreak {
+			return nil, errCBORBreak
+		}
+		return cborTag(n, x)
+	default:
+		return cborSimple(info, n)
+	}
+}
+
+// readCBORString reads the byte or text string, the indefinite one is concatenated by its chunks.
+func readCBORString(r *bufio.Reader, major byte, n uint64) ([]byte, error) {
+	if n != indefinite {
+		return readBytes(r, n)
+	}
+	var s []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if b == 0xff {
+			return s, nil
+		}
+		if b>>5 != major || b&0x1f == 31 {
+			return nil, errors.New("ws: invalid CBOR string chunk")
+		}
+		m := uint64(b & 0x1f)
+		if m >= 24 {
+			if m > 27 {
+				return nil, errors.New("ws: invalid CBOR string chunk")
+			}
+			if m, err = readUint(r, 1<<(m-24)); err != nil {
+				return nil, err
+			}
+		}
+		chunk, err := readBytes(r, m)
+		if err != nil {
+			return nil, err
+		}
+		if len(s)+len(chunk) > math.MaxInt32 {
+			return nil, errors.New("ws: data item too large")
+		}
+		s = append(s, chunk...)
+	}
+}
+
+// cborTag returns the tagged item, the date/time tags are converted to time.Time and the others are ignored.
+func cborTag(tag uint64, x interface{}) (interface{}, error) {
+	switch tag {
+	case 0:
+		s, ok := x.(string)
+		if !ok {
+			return nil, errors.New("ws: invalid CBOR date/time string")
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	case 1:
+		switch x := x.(type) {
+		case int64:
+			return time.Unix(x, 0), nil
+		case float64:
+			sec, frac := math.Modf(x)
+			return time.Unix(int64(sec), int64(frac*1e9)), nil
+		default:
+			return nil, errors.New("ws: invalid CBOR epoch date/time")
+		}
+	default:
+		return x, nil
+	}
+}
+
+// cborSimple returns the simple value or float of the major type 7.
+func cborSimple(info byte, n uint64) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return halfFloat(uint16(n)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(n))), nil
+	case 27:
+		return math.Float64frombits(n), nil
+	default:
+		return nil, errors.New("ws: unsupported CBOR simple value " + strconv.FormatUint(n, 10))
+	}
+}
+
+// halfFloat converts the IEEE 754 half precision float.
+func halfFloat(h uint16) float64 {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
@@ -0,0 +1,317 @@
+package ws
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// msgpackCodec encodes and decodes the values as MessagePack, the struct fields are named by the msgpack tags.
+// The timestamp extension is decoded into time.Time, and time.Time is encoded as RFC 3339 string.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Encode(w io.Writer, value interface{}) error {
+	bw := bufio.NewWriter(w)
+	if err := encodeBinary(msgpackWriter{bw}, reflect.ValueOf(value), "msgpack", 0); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func (msgpackCodec) Decode(r io.Reader, value interface{}, opts DecodeOptions) error {
+	br := bufio.NewReader(r)
+	x, err := readMsgpack(br, 0)
+	if err != nil {
+		return err
+	}
+	if opts.DisallowTrailingData {
+		if err := checkEOF(br); err != nil {
+			return err
+		}
+	}
+	return assignValue(value, x, "msgpack", opts)
+}
+
+type msgpackWriter struct {
+	w *bufio.Writer
+}
+
+func (a msgpackWriter) head(b byte, n uint64, size int) {
+	a.w.WriteByte(b)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	a.w.Write(buf[8-size:])
+}
+
+func (a msgpackWriter) writeNil() {
+	a.w.WriteByte(0xc0)
+}
+
+func (a msgpackWriter) writeBool(b bool) {
+	if b {
+		a.w.WriteByte(0xc3)
+	} else {
+		a.w.WriteByte(0xc2)
+	}
+}
+
+func (a msgpackWriter) writeInt(i int64) {
+	switch {
+	case i >= 0:
+		a.writeUint(uint64(i))
+	case i >= -32:
+		a.w.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		a.head(0xd0, uint64(i), 1)
+	case i >= math.MinInt16:
+		a.head(0xd1, uint64(i), 2)
+	case i >= math.MinInt32:
+		a.head(0xd2, uint64(i), 4)
+	default:
+		a.head(0xd3, uint64(i), 8)
+	}
+}
+
+func (a msgpackWriter) writeUint(u uint64) {
+	switch {
+	case u < 0x80:
+		a.w.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		a.head(0xcc, u, 1)
+	case u <= math.MaxUint16:
+		a.head(0xcd, u, 2)
+	case u <= math.MaxUint32:
+		a.head(0xce, u, 4)
+	default:
+		a.head(0xcf, u, 8)
+	}
+}
+
+func (a msgpackWriter) writeFloat(f float64, bits int) {
+	if bits == 32 {
+		a.head(0xca, uint64(math.Float32bits(float32(f))), 4)
+	} else {
+		a.head(0xcb, math.Float64bits(f), 8)
+	}
+}
+
+func (a msgpackWriter) writeString(s string) {
+	n := uint64(len(s))
+	switch {
+	case n < 32:
+		a.w.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		a.head(0xd9, n, 1)
+	case n <= math.MaxUint16:
+		a.head(0xda, n, 2)
+	default:
+		a.head(0xdb, n, 4)
+	}
+	a.w.WriteString(s)
+}
+
+func (a msgpackWriter) writeBytes(b []byte) {
+	n := uint64(len(b))
+	switch {
+	case n <= math.MaxUint8:
+		a.head(0xc4, n, 1)
+	case n <= math.MaxUint16:
+		a.head(0xc5, n, 2)
+	default:
+		a.head(0xc6, n, 4)
+	}
+	a.w.Write(b)
+}
+
+func (a msgpackWriter) writeArray(n int) {
+	switch {
+	case n < 16:
+		a.w.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		a.head(0xdc, uint64(n), 2)
+	default:
+		a.head(0xdd, uint64(n), 4)
+	}
+}
+
+func (a msgpackWriter) writeMap(n int) {
+	switch {
+	case n < 16:
+		a.w.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		a.head(0xde, uint64(n), 2)
+	default:
+		a.head(0xdf, uint64(n), 4)
+	}
+}
+
+// readUint reads the big endian unsigned integer of size bytes.
+func readUint(r *bufio.Reader, size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[8-size:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+// readMsgpack reads a MessagePack data item into the generic value.
+func readMsgpack(r *bufio.Reader, depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errTooDeep
+	}
+	b, err := r.ReadByte()
+	if err != nil {
+		if err == io.EOF && depth > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	switch {
+	case b < 0x80:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xe0 == 0xa0:
+		s, err := readBytes(r, uint64(b&0x1f))
+		return string(s), err
+	case b&0xf0 == 0x90:
+		return readMsgpackArray(r, uint64(b&0x0f), depth)
+	case b&0xf0 == 0x80:
+		return readMsgpackMap(r, uint64(b&0x0f), depth)
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := readUint(r, 1<<(b-0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if u <= math.MaxInt64 {
+			return int64(u), nil
+		}
+		return u, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		u, err := readUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+		shift := uint(64 - 8*size)
+		return int64(u<<shift) >> shift, nil
+	case 0xca:
+		u, err := readUint(r, 4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := readUint(r, 8)
+		return math.Float64frombits(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := readUint(r, 1<<(b-0xd9))
+		if err != nil {
+			return nil, err
+		}
+		s, err := readBytes(r, n)
+		return string(s), err
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readUint(r, 1<<(b-0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return readBytes(r, n)
+	case 0xdc, 0xdd:
+		n, err := readUint(r, 2<<(b-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackArray(r, n, depth)
+	case 0xde, 0xdf:
+		n, err := readUint(r, 2<<(b-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackMap(r, n, depth)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return readMsgpackExt(r, 1<<(b-0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := readUint(r, 1<<(b-0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackExt(r, n)
+	default:
+		return nil, errors.New("ws: invalid MessagePack byte 0x" + strconv.FormatUint(uint64(b), 16))
+	}
+}
+
+func readMsgpackArray(r *bufio.Reader, n uint64, depth int) (interface{}, error) {
+	xs := make([]interface{}, 0, capacity(n))
+	for i := uint64(0); i < n; i++ {
+		x, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		xs = append(xs, x)
+	}
+	return xs, nil
+}
+
+func readMsgpackMap(r *bufio.Reader, n uint64, depth int) (interface{}, error) {
+	keys := make([]interface{}, 0, capacity(n))
+	values := make([]interface{}, 0, capacity(n))
+	for i := uint64(0); i < n; i++ {
+		k, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if k, err = mapKey(k); err != nil {
+			return nil, err
+		}
+		x, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+		values = append(values, x)
+	}
+	return newMap(keys, values), nil
+}
+
+// readMsgpackExt reads the extension of n bytes data, only the timestamp extension is supported.
+func readMsgpackExt(r *bufio.Reader, n uint64) (interface{}, error) {
+	t, err := r.ReadByte()
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b, err := readBytes(r, n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(t) != -1 {
+		return nil, errors.New("ws: unsupported MessagePack extension " + strconv.Itoa(int(int8(t))))
+	}
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(b)), 0), nil
+	case 8:
+		u := binary.BigEndian.Uint64(b)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(b[4:])), int64(binary.BigEndian.Uint32(b))), nil
+	default:
+		return nil, errors.New("ws: invalid MessagePack timestamp")
+	}
+}
@@ -0,0 +1,202 @@
+package ws
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type codecInner struct {
+	Label string  `json:"label"`
+	Score float64 `json:"score"`
+}
+
+type codecValue struct {
+	Name    string            `json:"name"`
+	Count   int               `json:"count"`
+	Ratio   float64           `json:"ratio"`
+	OK      bool              `json:"ok"`
+	Tags    []string          `json:"tags"`
+	Data    []byte            `json:"data"`
+	When    time.Time         `json:"when"`
+	Wait    time.Duration     `json:"wait"`
+	Ptr     *int              `json:"ptr"`
+	Nil     *int              `json:"nil"`
+	Inner   codecInner        `json:"inner"`
+	Items   []codecInner      `json:"items"`
+	Attrs   map[string]string `json:"attrs"`
+	Matrix  [][]int           `json:"matrix"`
+	Comment string            `json:"comment"`
+}
+
+func newCodecValue() codecValue {
+	n := 7
+	return codecValue{
+		Name:    "null",
+		Count:   -3,
+		Ratio:   0.25,
+		OK:      true,
+		Tags:    []string{"a", "b c", "- d", ""},
+		Data:    []byte("bytes"),
+		When:    time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Wait:    1500 * time.Millisecond,
+		Ptr:     &n,
+		Inner:   codecInner{"x: y", 1.5},
+		Items:   []codecInner{{"one", 1}, {"two\nlines", 2}},
+		Attrs:   map[string]string{"k": "v", "a:b": " padded ", "#c": `"quoted"`},
+		Matrix:  [][]int{{1, 2}, {3}},
+		Comment: "# not a comment",
+	}
+}
+
+func roundTrip(t *testing.T, c Codec, in, out interface{}) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := c.Encode(&buf, in); err != nil {
+		t.Fatalf("%T.Encode = %v", c, err)
+	}
+	if err := c.Decode(bytes.NewReader(buf.Bytes()), out, DecodeOptions{}); err != nil {
+		t.Fatalf("%T.Decode = %v\n%s", c, err, buf.Bytes())
+	}
+	if got := reflect.ValueOf(out).Elem().Interface(); !reflect.DeepEqual(got, in) {
+		t.Errorf("%T round trip = %+v, want %+v\n%s", c, got, in, buf.Bytes())
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, c := range []Codec{jsonCodec{}, textCodec{}, msgpackCodec{}, cborCodec{}} {
+		var out codecValue
+		roundTrip(t, c, newCodecValue(), &out)
+	}
+}
+
+func TestTextCodec(t *testing.T) {
+	var s string
+	roundTrip(t, textCodec{}, "raw\ntext: as it is", &s)
+	var n int
+	roundTrip(t, textCodec{}, 42, &n)
+	var when time.Time
+	roundTrip(t, textCodec{}, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), &when)
+	var m map[int][]string
+	roundTrip(t, textCodec{}, map[int][]string{1: {"a"}, 2: {"b", "c"}}, &m)
+
+	var buf bytes.Buffer
+	if err := (textCodec{}).Encode(&buf, struct{ C chan int }{}); err == nil {
+		t.Error("text encoded a channel")
+	}
+	var v codecValue
+	for _, s := range []string{"name: a\n bad: b\n", "name\n", "name:a\n", "tags:\n  - a\n x\n"} {
+		if err := (textCodec{}).Decode(strings.NewReader(s), &v, DecodeOptions{}); err == nil {
+			t.Errorf("text decoded %q", s)
+		}
+	}
+	if err := (textCodec{}).Decode(strings.NewReader("# comment\nname: a\nx: 1\n"), &v, DecodeOptions{DisallowUnknownFields: true}); err == nil {
+		t.Error("text decoded the unknown field")
+	}
+}
+
+type csvRow struct {
+	Name  string        `csv:"name"`
+	Count int           `csv:"count"`
+	Data  []byte        `csv:"data"`
+	When  time.Time     `csv:"when"`
+	Wait  time.Duration `csv:"wait"`
+	Ptr   *float64      `csv:"ptr"`
+}
+
+func TestCSVCodec(t *testing.T) {
+	f := 0.5
+	in := []csvRow{
+		{"a,b", 1, []byte("x\ny"), time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), time.Second, &f},
+		{"\"q\"", 2, []byte("z"), time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), time.Minute, &f},
+	}
+	var out []csvRow
+	roundTrip(t, csvCodec{}, in, &out)
+
+	var buf bytes.Buffer
+	for _, v := range []interface{}{
+		map[string]int{"a": 1},
+		codecInner{},
+		[]struct{ Tags []string }{{[]string{"a"}}},
+		[]struct{ Inner codecInner }{{}},
+	} {
+		if err := (csvCodec{}).Encode(&buf, v); err == nil {
+			t.Errorf("csv encoded %T", v)
+		}
+	}
+}
+
+func TestFormCodec(t *testing.T) {
+	type form struct {
+		Name string   `form:"name"`
+		Tags []string `form:"tag"`
+		Data []byte   `form:"data"`
+		N    int      `form:"n"`
+	}
+	var out form
+	roundTrip(t, formCodec{}, form{"a b", []string{"x", "y"}, []byte("z"), 3}, &out)
+
+	var buf bytes.Buffer
+	if err := (formCodec{}).Encode(&buf, struct{ Inner codecInner }{}); err == nil {
+		t.Error("form encoded the nested struct")
+	}
+}
+
+func TestRenderCodecs(t *testing.T) {
+	s := New()
+	s.Get("/map", func(ctx *Context) error {
+		return ctx.Render(map[string]int{"a": 1})
+	})
+	s.Get("/rows", func(ctx *Context) error {
+		return ctx.Render([]csvRow{{Name: "a"}})
+	})
+	cases := []struct {
+		path   string
+		accept string
+		code   int
+		ct     string
+	}{
+		{"/map", "text/csv", http.StatusNotAcceptable, ""},
+		{"/map", "text/csv, application/cbor;q=0.5", http.StatusOK, "application/cbor"},
+		{"/rows", "text/csv", http.StatusOK, "text/csv"},
+		{"/rows", "application/x-www-form-urlencoded", http.StatusNotAcceptable, ""},
+		{"/map", "application/msgpack", http.StatusOK, "application/msgpack"},
+	}
+	for _, c := range cases {
+		w := serve(s, http.MethodGet, c.path, nil, "Accept", c.accept)
+		if ct := w.Header().Get("Content-Type"); w.Code != c.code || !strings.HasPrefix(ct, c.ct) {
+			t.Errorf("GET %s Accept %q = %d %q, want %d %q", c.path, c.accept, w.Code, ct, c.code, c.ct)
+		}
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	const mt = "application/x-test"
+	RegisterEncoder(mt, func(w io.Writer, value interface{}) error {
+		_, err := fmt.Fprintf(w, "<%v>", value)
+		return err
+	})
+	defer func() {
+		codecs = codecs[:len(codecs)-1]
+	}()
+
+	s := New()
+	s.Get("/", func(ctx *Context) error {
+		return ctx.Render(1)
+	})
+	s.Post("/", func(ctx *Context) error {
+		var v interface{}
+		return ctx.Parse(&v)
+	})
+	if w := serve(s, http.MethodGet, "/", nil, "Accept", mt); w.Code != http.StatusOK || w.Body.String() != "<1>" {
+		t.Errorf("Render = %d %q", w.Code, w.Body.String())
+	}
+	if w := serve(s, http.MethodPost, "/", strings.NewReader("x"), "Content-Type", mt); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Parse = %d, want 415", w.Code)
+	}
+}
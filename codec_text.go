@@ -0,0 +1,682 @@
+package ws
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// csvCodec encodes and decodes the slices of structs as CSV with a header row,
+// the columns are named by the csv tags.
+type csvCodec struct{}
+
+func (csvCodec) Encode(w io.Writer, value interface{}) error {
+	cw := csv.NewWriter(w)
+	if records, ok := value.([][]string); ok {
+		return writeCSV(cw, records)
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(value))
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return errors.New("ws: csv encodes slices of structs only")
+	}
+	t := v.Type().Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return errors.New("ws: csv encodes slices of structs only")
+	}
+
+	fs := fieldsOf(t, "csv")
+	records := make([][]string, 0, v.Len()+1)
+	header := make([]string, len(fs))
+	for i, f := range fs {
+		if ft := t.FieldByIndex(f.index).Type; !isScalar(ft) {
+			return errors.New("ws: csv cannot encode column " + strconv.Quote(f.name) + " of " + ft.String())
+		}
+		header[i] = f.name
+	}
+	records = append(records, header)
+	for i := 0; i < v.Len(); i++ {
+		e := reflect.Indirect(v.Index(i))
+		record := make([]string, len(fs))
+		if e.IsValid() {
+			for j, f := range fs {
+				record[j] = formatValue(e.FieldByIndex(f.index))
+			}
+		}
+		records = append(records, record)
+	}
+	return writeCSV(cw, records)
+}
+
+func writeCSV(cw *csv.Writer, records [][]string) error {
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func (csvCodec) Decode(r io.Reader, value interface{}, opts DecodeOptions) error {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	if p, ok := value.(*[][]string); ok {
+		*p = records
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return errors.New("ws: csv decodes into pointers to slices of structs only")
+	}
+	v = v.Elem()
+	t := v.Type().Elem()
+	et := t
+	for et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Struct {
+		return errors.New("ws: csv decodes into pointers to slices of structs only")
+	}
+	if len(records) == 0 {
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		return nil
+	}
+
+	fields := make(map[string][]int)
+	for _, f := range fieldsOf(et, "csv") {
+		fields[f.name] = f.index
+	}
+	header := records[0]
+	for _, name := range header {
+		if _, ok := fields[name]; !ok && opts.DisallowUnknownFields {
+			return errors.New("ws: csv unknown column " + strconv.Quote(name))
+		}
+	}
+
+	s := reflect.MakeSlice(v.Type(), len(records)-1, len(records)-1)
+	for i, record := range records[1:] {
+		e := s.Index(i)
+		for e.Kind() == reflect.Ptr {
+			e.Set(reflect.New(e.Type().Elem()))
+			e = e.Elem()
+		}
+		for j, cell := range record {
+			index, ok := fields[header[j]]
+			if !ok || cell == "" {
+				continue
+			}
+			if err := setValue(e.FieldByIndex(index), cell); err != nil {
+				return fmt.Errorf("ws: csv line %d column %q: %v", i+2, header[j], err)
+			}
+		}
+	}
+	v.Set(s)
+	return nil
+}
+
+// formCodec encodes and decodes the url.Values, maps of strings and structs
+// as application/x-www-form-urlencoded, the struct fields are named by the form tags.
+type formCodec struct{}
+
+func (formCodec) Encode(w io.Writer, value interface{}) error {
+	values := make(url.Values)
+	switch x := value.(type) {
+	case url.Values:
+		values = x
+	case map[string][]string:
+		values = x
+	case map[string]string:
+		for k, s := range x {
+			values.Set(k, s)
+		}
+	default:
+		v := reflect.Indirect(reflect.ValueOf(value))
+		if v.Kind() != reflect.Struct {
+			return errors.New("ws: form encodes url.Values, maps of strings and structs only")
+		}
+		for _, f := range fieldsOf(v.Type(), "form") {
+			fv := v.FieldByIndex(f.index)
+			ft := fv.Type()
+			if ft.Kind() == reflect.Slice && !isScalar(ft) {
+				ft = ft.Elem()
+			}
+			if !isScalar(ft) {
+				return errors.New("ws: form cannot encode field " + strconv.Quote(f.name) + " of " + fv.Type().String())
+			}
+			if fv.Kind() == reflect.Slice && !isScalar(fv.Type()) {
+				for i := 0; i < fv.Len(); i++ {
+					values.Add(f.name, formatValue(fv.Index(i)))
+				}
+				continue
+			}
+			values.Set(f.name, formatValue(fv))
+		}
+	}
+	_, err := io.WriteString(w, values.Encode())
+	return err
+}
+
+func (formCodec) Decode(r io.Reader, value interface{}, opts DecodeOptions) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return err
+	}
+
+	switch x := value.(type) {
+	case *url.Values:
+		*x = values
+		return nil
+	case *map[string][]string:
+		*x = values
+		return nil
+	case *map[string]string:
+		*x = make(map[string]string, len(values))
+		for k := range values {
+			(*x)[k] = values.Get(k)
+		}
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("ws: form decodes into url.Values, maps of strings and structs only")
+	}
+	return setFields(v.Elem(), "form", values, opts)
+}
+
+// textCodec encodes the values as YAML like plain text, the nested structs, maps and slices are indented,
+// and the scalars which cannot be read back as they are, such as multiline texts, are quoted.
+// The strings and []byte are written as they are. It decodes its own output.
+type textCodec struct{}
+
+func (textCodec) Encode(w io.Writer, value interface{}) error {
+	switch x := value.(type) {
+	case string:
+		_, err := io.WriteString(w, x)
+		return err
+	case []byte:
+		_, err := w.Write(x)
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	v := reflect.ValueOf(value)
+	if e := textElem(v); isText(e) {
+		s, err := textScalar(e, true)
+		if err != nil {
+			return err
+		}
+		bw.WriteString(s + "\n")
+	} else if err := writeText(bw, e, ""); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// textElem returns the value which v points to, or the invalid value if v is nil.
+func textElem(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// textScalar formats the scalar value, key reports whether it is a key or a top level value.
+func textScalar(v reflect.Value, key bool) (string, error) {
+	if !v.IsValid() {
+		return "null", nil
+	}
+	if !isScalar(v.Type()) {
+		return "", errors.New("ws: text cannot encode " + v.Type().String())
+	}
+	s := formatValue(v)
+	quote := s == "" || s == "null" || s != strings.TrimSpace(s) || strings.ContainsAny(s, "\r\n") || strings.HasPrefix(s, `"`)
+	if key {
+		quote = quote || strings.ContainsRune(s, ':') || s[0] == '-' || s[0] == '#'
+	}
+	if quote {
+		s = strconv.Quote(s)
+	}
+	return s, nil
+}
+
+// writeText writes the struct, map or slice v, the lines are prefixed by indent.
+func writeText(w *bufio.Writer, v reflect.Value, indent string) error {
+	var keys []string
+	var values []reflect.Value
+	switch v.Kind() {
+	case reflect.Struct:
+		for _, f := range fieldsOf(v.Type(), "text") {
+			keys = append(keys, f.name)
+			values = append(values, v.FieldByIndex(f.index))
+		}
+	case reflect.Map:
+		ks := v.MapKeys()
+		keys = make([]string, len(ks))
+		for i, k := range ks {
+			s, err := textScalar(textElem(k), true)
+			if err != nil {
+				return err
+			}
+			keys[i] = s
+		}
+		sort.Sort(mapKeys{keys, ks})
+		for _, k := range ks {
+			values = append(values, v.MapIndex(k))
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := writeTextEntry(w, indent+"-", textElem(v.Index(i)), indent); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return errors.New("ws: text cannot encode " + v.Type().String())
+	}
+
+	for i, k := range keys {
+		if err := writeTextEntry(w, indent+k+":", textElem(values[i]), indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTextEntry writes the list item or the map entry, which is the prefix followed by the value.
+func writeTextEntry(w *bufio.Writer, prefix string, v reflect.Value, indent string) error {
+	if isText(v) {
+		s, err := textScalar(v, false)
+		if err != nil {
+			return err
+		}
+		w.WriteString(prefix + " " + s + "\n")
+		return nil
+	}
+	w.WriteString(prefix + "\n")
+	return writeText(w, v, indent+"  ")
+}
+
+// mapKeys sorts the formatted keys and the map keys together.
+type mapKeys struct {
+	keys []string
+	ks   []reflect.Value
+}
+
+func (a mapKeys) Len() int {
+	return len(a.keys)
+}
+
+func (a mapKeys) Less(i, j int) bool {
+	return a.keys[i] < a.keys[j]
+}
+
+func (a mapKeys) Swap(i, j int) {
+	a.keys[i], a.keys[j] = a.keys[j], a.keys[i]
+	a.ks[i], a.ks[j] = a.ks[j], a.ks[i]
+}
+
+func (textCodec) Decode(r io.Reader, value interface{}, opts DecodeOptions) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	switch x := value.(type) {
+	case *string:
+		*x = string(b)
+		return nil
+	case *[]byte:
+		*x = b
+		return nil
+	}
+
+	var lines []textLine
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimRight(line, "\r")
+		text := strings.TrimLeft(line, " ")
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		lines = append(lines, textLine{i + 1, len(line) - len(text), text})
+	}
+	p := &textParser{lines: lines}
+	var x interface{}
+	if len(lines) == 1 && !lines[0].isItem() && textColon(lines[0].text) < 0 {
+		x, err = textValue(lines[0].text)
+		p.i++
+	} else if len(lines) > 0 {
+		x, err = p.block(lines[0].indent)
+	}
+	if err == nil && p.i < len(lines) {
+		err = p.errorf("bad indentation")
+	}
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("ws: decode into non pointer")
+	}
+	return assignText(v.Elem(), x, opts)
+}
+
+type textLine struct {
+	no     int
+	indent int
+	text   string
+}
+
+func (a textLine) isItem() bool {
+	return a.text == "-" || strings.HasPrefix(a.text, "- ")
+}
+
+// textParser parses the lines into the nested map[string]interface{}, []interface{}, string and nil.
+type textParser struct {
+	lines []textLine
+	i     int
+}
+
+func (a *textParser) errorf(format string, args ...interface{}) error {
+	no := 0
+	if a.i < len(a.lines) {
+		no = a.lines[a.i].no
+	}
+	return fmt.Errorf("ws: text line %d: "+format, append([]interface{}{no}, args...)...)
+}
+
+// block parses the list or the map whose lines are indented by indent.
+func (a *textParser) block(indent int) (interface{}, error) {
+	if a.lines[a.i].isItem() {
+		var list []interface{}
+		for a.i < len(a.lines) && a.lines[a.i].indent == indent && a.lines[a.i].isItem() {
+			x, err := a.entry(indent, strings.TrimPrefix(a.lines[a.i].text[1:], " "), a.lines[a.i].text == "-")
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, x)
+		}
+		return list, nil
+	}
+
+	m := make(map[string]interface{})
+	for a.i < len(a.lines) && a.lines[a.i].indent == indent && !a.lines[a.i].isItem() {
+		text := a.lines[a.i].text
+		k := textColon(text)
+		if k < 0 {
+			return nil, a.errorf("missing colon")
+		}
+		key, err := textKey(text[:k])
+		if err != nil {
+			return nil, a.errorf("%v", err)
+		}
+		rest := text[k+1:]
+		if rest != "" && rest[0] != ' ' {
+			return nil, a.errorf("missing space after colon")
+		}
+		x, err := a.entry(indent, strings.TrimPrefix(rest, " "), rest == "")
+		if err != nil {
+			return nil, err
+		}
+		m[key] = x
+	}
+	return m, nil
+}
+
+// entry parses the value of the current line, nested reports whether the value is the indented block below.
+func (a *textParser) entry(indent int, text string, nested bool) (interface{}, error) {
+	if !nested {
+		x, err := textValue(text)
+		if err != nil {
+			return nil, a.errorf("%v", err)
+		}
+		a.i++
+		return x, nil
+	}
+	a.i++
+	if a.i >= len(a.lines) || a.lines[a.i].indent <= indent {
+		return nil, nil
+	}
+	return a.block(a.lines[a.i].indent)
+}
+
+// textColon returns the index of the colon after the key, or -1 if there is no colon.
+func textColon(text string) int {
+	if text == "" || text[0] != '"' {
+		return strings.IndexByte(text, ':')
+	}
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			if k := strings.IndexByte(text[i+1:], ':'); k >= 0 {
+				return i + 1 + k
+			}
+			return -1
+		}
+	}
+	return -1
+}
+
+func textKey(s string) (string, error) {
+	if strings.HasPrefix(s, `"`) {
+		return strconv.Unquote(s)
+	}
+	return s, nil
+}
+
+// textValue parses the scalar, which is nil if it is null.
+func textValue(s string) (interface{}, error) {
+	switch {
+	case s == "null":
+		return nil, nil
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	default:
+		return s, nil
+	}
+}
+
+// assignText assigns the parsed x to the addressable v, the scalars are parsed by setValue.
+func assignText(v reflect.Value, x interface{}, opts DecodeOptions) error {
+	if x == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		v.Set(reflect.ValueOf(x))
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assignText(v.Elem(), x, opts)
+	}
+
+	switch x := x.(type) {
+	case string:
+		return setValue(v, x)
+	case []interface{}:
+		switch v.Kind() {
+		case reflect.Slice:
+			s := reflect.MakeSlice(v.Type(), len(x), len(x))
+			for i, e := range x {
+				if err := assignText(s.Index(i), e, opts); err != nil {
+					return err
+				}
+			}
+			v.Set(s)
+			return nil
+		case reflect.Array:
+			if len(x) > v.Len() {
+				break
+			}
+			for i, e := range x {
+				if err := assignText(v.Index(i), e, opts); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case map[string]interface{}:
+		switch v.Kind() {
+		case reflect.Map:
+			m := reflect.MakeMap(v.Type())
+			for k, e := range x {
+				kv := reflect.New(v.Type().Key()).Elem()
+				if err := setValue(kv, k); err != nil {
+					return err
+				}
+				ev := reflect.New(v.Type().Elem()).Elem()
+				if err := assignText(ev, e, opts); err != nil {
+					return err
+				}
+				m.SetMapIndex(kv, ev)
+			}
+			v.Set(m)
+			return nil
+		case reflect.Struct:
+			fields := make(map[string][]int)
+			for _, f := range fieldsOf(v.Type(), "text") {
+				fields[f.name] = f.index
+			}
+			for k, e := range x {
+				index, ok := fields[k]
+				if !ok {
+					if opts.DisallowUnknownFields {
+						return errors.New("ws: unknown field " + strconv.Quote(k))
+					}
+					continue
+				}
+				if err := assignText(v.FieldByIndex(index), e, opts); err != nil {
+					return fmt.Errorf("ws: field %q: %v", k, err)
+				}
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("ws: text cannot decode %T into %s", x, v.Type())
+}
+
+// setFields sets the struct fields named by the tag from values.
+func setFields(v reflect.Value, tag string, values url.Values, opts DecodeOptions) error {
+	fields := make(map[string][]int)
+	for _, f := range fieldsOf(v.Type(), tag) {
+		fields[f.name] = f.index
+	}
+	for k, vs := range values {
+		index, ok := fields[k]
+		if !ok {
+			if opts.DisallowUnknownFields {
+				return errors.New("ws: unknown field " + strconv.Quote(k))
+			}
+			continue
+		}
+		if err := setValues(v.FieldByIndex(index), vs); err != nil {
+			return fmt.Errorf("ws: field %q: %v", k, err)
+		}
+	}
+	return nil
+}
+
+// isText reports whether v is formatted as a single text.
+func isText(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	if _, ok := v.Interface().(encoding.TextMarshaler); ok {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Array:
+		return false
+	case reflect.Slice:
+		return v.Type().Elem().Kind() == reflect.Uint8
+	default:
+		return true
+	}
+}
+
+// isScalar reports whether the values of t are formatted by formatValue and parsed back by setValue.
+func isScalar(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Implements(textMarshalerType) && reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	default:
+		return false
+	}
+}
+
+// formatValue formats the scalar value as text.
+func formatValue(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return ""
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+	if v.Type() == durationType {
+		return v.Interface().(fmt.Stringer).String()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes())
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -1,14 +1,15 @@
 package ws
 
 import (
-	"encoding/json"
-	"encoding/xml"
+	"bufio"
+	"context"
 	"io"
 	"mime/multipart"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -19,72 +20,94 @@ type Context struct {
 	ResponseWriter http.ResponseWriter
 	Path           string
 
-	code   int
-	datas  map[string]interface{}
-	params map[string]string
-	querys url.Values
-	router *Router
-	index  int
+	code     int
+	response Response
+	before   []func(*Context)
+	after    []func(*Context)
+	cancel   context.CancelFunc
+	datas    map[string]interface{}
+	querys   url.Values
+	router   *Router
+	matches  []match
+	names    []string
+	depth    int
+	index    int
 }
 
 // Next calls the next handler.
 func (a *Context) Next() error {
-	ctx := ctxPool.Get().(*Context)
-	defer ctxPool.Put(ctx)
-	ctx.Request = a.Request
-	ctx.ResponseWriter = a.ResponseWriter
-	ctx.Path = a.Path
-	ctx.code = 0
-	ctx.datas = a.datas
-	ctx.params = a.params
-	ctx.querys = a.querys
-	ctx.router = a.router
-	ctx.index = a.index + 1
-
-	if a.index < 0 {
-		ms := a.router.middlewares
-		return ms[a.index+len(ms)](ctx)
-	}
-
-	if a.Path == "" {
-		method := a.Request.Method
-		if method == http.MethodOptions {
-			allow := []string{http.MethodOptions}
-			for m := range a.router.handlers {
-				allow = append(allow, m)
-				if m == http.MethodGet {
-					allow = append(allow, http.MethodHead)
-				}
+	depth, index, path := a.depth, a.index, a.Path
+	err := a.next()
+	a.depth, a.index, a.Path = depth, index, path
+	return err
+}
+
+func (a *Context) next() error {
+	ms := a.matches[a.depth].node.middlewares
+	for a.index >= len(ms) && a.depth+1 < len(a.matches) {
+		a.depth++
+		a.index = 0
+		a.Path = a.matches[a.depth].path
+		ms = a.matches[a.depth].node.middlewares
+	}
+	a.index++
+	if a.index <= len(ms) {
+		return ms[a.index-1](a)
+	}
+
+	i := a.index - len(ms) - 1
+	n := a.matches[a.depth].node
+	if a.Path != "" || len(n.routes) == 0 {
+		return a.hook(i, notFound, Status(http.StatusNotFound, a.Request.URL.Path))
+	}
+	method := a.Request.Method
+	if method == http.MethodOptions {
+		allow := []string{http.MethodOptions}
+		for m := range n.routes {
+			allow = append(allow, m)
+			if m == http.MethodGet {
+				allow = append(allow, http.MethodHead)
 			}
-			a.ResponseWriter.Header().Add("Allow", strings.Join(allow, ", "))
-			return Status(http.StatusOK, "")
-		}
-		if method == http.MethodHead {
-			method = http.MethodGet
 		}
+		a.ResponseWriter.Header().Add("Allow", strings.Join(allow, ", "))
+		return Status(http.StatusOK, "")
+	}
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
 
-		hs, ok := a.router.handlers[method]
-		if !ok {
-			return Status(http.StatusMethodNotAllowed, a.Request.Method+" "+a.Request.URL.Path)
-		}
-		if a.index < len(hs) {
-			return hs[a.index](ctx)
-		}
-		return nil
+	r, ok := n.routes[method]
+	if !ok {
+		return a.hook(i, methodNotAllowed, Status(http.StatusMethodNotAllowed, a.Request.Method+" "+a.Request.URL.Path))
+	}
+	if i < len(r.handlers) {
+		return r.handlers[i](a)
 	}
+	return nil
+}
 
-	router, path, param := a.router.Match(a.Path)
-	if router == nil {
-		return Status(http.StatusNotFound, a.Request.URL.Path)
+// hook calls the hook of the deepest matched node which has one, or returns err.
+// If the hook calls Next, err is returned to it.
+func (a *Context) hook(i int, get func(*node) func(*Context) error, err error) error {
+	if i > 0 {
+		return err
 	}
-	if key := a.router.key; key != "" {
-		a.params[key[1:]] = param
+	for k := len(a.matches) - 1; k >= 0; k-- {
+		if h := get(a.matches[k].node); h != nil {
+			return h(a)
+		}
 	}
+	return err
+}
 
-	ctx.Path = path
-	ctx.router = router
-	ctx.index = -len(router.middlewares)
-	return ctx.Next()
+// errorHandler returns the error handler of the deepest matched node which has one.
+func (a *Context) errorHandler() func(*Context, error) {
+	for k := len(a.matches) - 1; k >= 0; k-- {
+		if h := a.matches[k].node.errorHandler; h != nil {
+			return h
+		}
+	}
+	return DefaultErrorHandler
 }
 
 // Status sets the status code.
@@ -92,6 +115,90 @@ func (a *Context) Status(code int) {
 	a.code = code
 }
 
+// Written reports whether the response header has been written or the connection has been hijacked.
+func (a *Context) Written() bool {
+	return a.response.Written()
+}
+
+// Response returns the wrapper of the response writer,
+// which records the status code, the body size and whether the header is written.
+func (a *Context) Response() *Response {
+	return &a.response
+}
+
+// BeforeWrite registers the hook called right before the response header is written,
+// which can modify the header. The status code to be written is returned by Response().Status().
+// The hooks are called in the reverse order of registration, and they are not called if the connection is hijacked.
+func (a *Context) BeforeWrite(fn func(*Context)) {
+	a.before = append(a.before, fn)
+}
+
+// AfterResponse registers the hook called after the response is completed, including the error handling.
+// The hooks are called in the reverse order of registration, and the context must not be retained after them.
+func (a *Context) AfterResponse(fn func(*Context)) {
+	a.after = append(a.after, fn)
+}
+
+func (a *Context) beforeWrite() {
+	hs := a.before
+	a.before = nil
+	for i := len(hs) - 1; i >= 0; i-- {
+		hs[i](a)
+	}
+}
+
+func (a *Context) afterResponse() {
+	for len(a.after) > 0 {
+		k := len(a.after) - 1
+		fn := a.after[k]
+		a.after[k] = nil
+		a.after = a.after[:k]
+		fn(a)
+	}
+	if a.cancel != nil {
+		a.cancel()
+		a.cancel = nil
+	}
+}
+
+// Deadline returns the deadline of the request context, see context.Context.
+func (a *Context) Deadline() (time.Time, bool) {
+	return a.Request.Context().Deadline()
+}
+
+// Done returns the done channel of the request context, see context.Context.
+func (a *Context) Done() <-chan struct{} {
+	return a.Request.Context().Done()
+}
+
+// Err returns the error of the request context, see context.Context.
+func (a *Context) Err() error {
+	return a.Request.Context().Err()
+}
+
+// Value returns the context data set by Set if the key is a string,
+// otherwise the value of the request context, see context.Context.
+// So the context can be passed to the functions which receive context.Context,
+// but it must not be used after the handler returns, see Copy, and Set must not be called concurrently with Value.
+func (a *Context) Value(key interface{}) interface{} {
+	if k, ok := key.(string); ok {
+		if v, ok := a.datas[k]; ok {
+			return v
+		}
+	}
+	return a.Request.Context().Value(key)
+}
+
+// deadline returns the deadline duration of the deepest matched node which has one.
+func (a *Context) deadline() time.Duration {
+	for k := len(a.matches) - 1; k >= 0; k-- {
+		if d := a.matches[k].node.deadline; d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
 // Get gets the context data.
 func (a *Context) Get(key string) interface{} {
 	return a.datas[key]
@@ -99,12 +206,63 @@ func (a *Context) Get(key string) interface{} {
 
 // Set sets the context data.
 func (a *Context) Set(key string, value interface{}) {
+	if a.datas == nil {
+		a.datas = make(map[string]interface{})
+	}
 	a.datas[key] = value
 }
 
 // Param return the param by key.
 func (a *Context) Param(key string) string {
-	return a.params[key]
+	v, _ := a.param(key)
+	return v
+}
+
+// ParamInt returns the param by key as int.
+func (a *Context) ParamInt(key string) (int, error) {
+	v, err := strconv.Atoi(a.Param(key))
+	if err != nil {
+		return 0, Status(http.StatusBadRequest, "param "+key+": "+err.Error())
+	}
+	return v, nil
+}
+
+// ParamInt64 returns the param by key as int64.
+func (a *Context) ParamInt64(key string) (int64, error) {
+	v, err := strconv.ParseInt(a.Param(key), 10, 64)
+	if err != nil {
+		return 0, Status(http.StatusBadRequest, "param "+key+": "+err.Error())
+	}
+	return v, nil
+}
+
+// ParamUUID returns the param by key as UUID.
+func (a *Context) ParamUUID(key string) (UUID, error) {
+	v, err := ParseUUID(a.Param(key))
+	if err != nil {
+		return v, Status(http.StatusBadRequest, "param "+key+": "+err.Error())
+	}
+	return v, nil
+}
+
+// URLFor builds the URL of the named route, pairs are the param keys and values.
+func (a *Context) URLFor(name string, pairs ...string) (string, error) {
+	return a.router.URL(name, pairs...)
+}
+
+// param returns the param by key, and reports whether it exists.
+func (a *Context) param(key string) (string, bool) {
+	i := 0
+	for _, m := range a.matches {
+		if !m.param {
+			continue
+		}
+		if i < len(a.names) && a.names[i] == key {
+			return m.value, true
+		}
+		i++
+	}
+	return "", false
 }
 
 // Query returns the first value associated with the given key.
@@ -124,27 +282,19 @@ func (a *Context) FormValue(key string) string {
 func (a *Context) FormFile(key string) (multipart.File, *multipart.FileHeader, error) {
 	f, fh, err := a.Request.FormFile(key)
 	if err != nil {
-		err = Status(http.StatusBadRequest, err.Error())
+		err = a.bodyError(err)
 	}
 	return f, fh, err
 }
 
-// ParseJSON parse the JSON data.
+// ParseJSON parse the JSON data by the decode options of the router.
 func (a *Context) ParseJSON(value interface{}) error {
-	err := json.NewDecoder(a.Request.Body).Decode(value)
-	if err != nil {
-		err = Status(http.StatusBadRequest, err.Error())
-	}
-	return err
+	return a.decode("application/json", value)
 }
 
-// ParseXML parse the XML data.
+// ParseXML parse the XML data by the decode options of the router.
 func (a *Context) ParseXML(value interface{}) error {
-	err := xml.NewDecoder(a.Request.Body).Decode(value)
-	if err != nil {
-		err = Status(http.StatusBadRequest, err.Error())
-	}
-	return err
+	return a.decode("application/xml", value)
 }
 
 // Text responses the text content.
@@ -157,26 +307,12 @@ func (a *Context) Text(value string) error {
 
 // JSON responses the JSON content.
 func (a *Context) JSON(value interface{}) error {
-	b, err := json.Marshal(value)
-	if err != nil {
-		return err
-	}
-	a.ResponseWriter.Header().Set("Content-Type", "application/json; charset=utf-8")
-	a.ResponseWriter.WriteHeader(a.statusCode())
-	a.ResponseWriter.Write(b)
-	return nil
+	return a.Encode("application/json", value)
 }
 
 // XML responses the XML content.
 func (a *Context) XML(value interface{}) error {
-	b, err := xml.Marshal(value)
-	if err != nil {
-		return err
-	}
-	a.ResponseWriter.Header().Set("Content-Type", "application/xml; charset=utf-8")
-	a.ResponseWriter.WriteHeader(a.statusCode())
-	a.ResponseWriter.Write(b)
-	return nil
+	return a.Encode("application/xml", value)
 }
 
 // Content responses the content.
@@ -213,6 +349,90 @@ func (a *Context) RealIP() string {
 	return ra
 }
 
+// Hijack takes over the connection, and the response is regarded as written.
+// It returns a 500 StatusError if the response writer does not support hijacking.
+func (a *Context) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := a.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, Status(http.StatusInternalServerError, "ws: response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+// ShutdownNotify returns a channel which is closed when the server starts shutting down.
+// The long-lived handlers should return on it, since the server waits for them.
+func (a *Context) ShutdownNotify() <-chan struct{} {
+	return a.router.shutdown
+}
+
+// Copy returns a snapshot of the context, which is safe to use after the handler returns, such as in a goroutine,
+// since the context itself is reused by the later requests.
+// The snapshot holds the request, the path, the params, a copy of the context datas and the response status.
+// It has no response writer, its Next must not be called, and its request body must not be read.
+// Its request context is still canceled when the request is done, see Detach and Fork.
+func (a *Context) Copy() *Context {
+	c := &Context{
+		Request: a.Request.WithContext(a.Request.Context()),
+		Path:    a.Path,
+		code:    a.code,
+		router:  a.router,
+		matches: append([]match(nil), a.matches...),
+		names:   a.names,
+		depth:   a.depth,
+		index:   a.index,
+	}
+	c.response = a.response
+	c.response.ResponseWriter = nil
+	c.response.ctx = nil
+	if a.datas != nil {
+		c.datas = make(map[string]interface{}, len(a.datas))
+		for k, v := range a.datas {
+			c.datas[k] = v
+		}
+	}
+	return c
+}
+
+// Detach is the same as Copy, but its request context is never canceled and has no deadline,
+// which keeps the values of the request context for the background tasks outliving the request.
+func (a *Context) Detach() *Context {
+	c := a.Copy()
+	c.Request = c.Request.WithContext(detached{a.Request.Context()})
+	return c
+}
+
+// Fork is the same as Copy, but it writes the response to w, and its Next calls the rest handlers,
+// so they can run in another goroutine, such as by the timeout middleware.
+// Its Written and Response report the response written to w, and its before-write hooks are called before writing w.
+// Its after-response hooks are never called, so they should be registered on the context before forking.
+func (a *Context) Fork(w http.ResponseWriter) *Context {
+	c := a.Copy()
+	c.response = Response{ResponseWriter: w, ctx: c}
+	c.ResponseWriter = c.response.writer()
+	return c
+}
+
+// detached is the context which keeps the values of its parent without the cancellation.
+type detached struct {
+	parent context.Context
+}
+
+func (a detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (a detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (a detached) Err() error {
+	return nil
+}
+
+func (a detached) Value(key interface{}) interface{} {
+	return a.parent.Value(key)
+}
+
 func (a *Context) statusCode() int {
 	if a.code > 0 {
 		return a.code
@@ -0,0 +1,94 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestContextCopy checks that the copies are not changed by the later requests reusing the pooled contexts,
+// it should be run with -race.
+func TestContextCopy(t *testing.T) {
+	const n = 200
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	start := make(chan struct{})
+	s := New()
+	s.Get("/users/:id/*path", func(ctx *Context) error {
+		ctx.Set("id", ctx.Param("id"))
+		ctx.Status(http.StatusAccepted)
+		c := ctx.Copy()
+		if len(ctx.Param("id"))%2 == 0 {
+			c = ctx.Detach()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			id := c.Param("id")
+			want := "/users/" + id + "/files/" + id
+			if c.Request.URL.Path != want || c.Param("path") != "files/"+id || c.Get("id") != id || c.Query("q") != id {
+				errs <- fmt.Errorf("copy of %s = %s %q %v %q", want, c.Request.URL.Path, c.Param("path"), c.Get("id"), c.Query("q"))
+			}
+			if c.Written() || c.Response().Status() != 0 || c.statusCode() != http.StatusAccepted {
+				errs <- fmt.Errorf("copy of %s: response = %v %d", want, c.Written(), c.statusCode())
+			}
+		}()
+		return ctx.Text("ok")
+	})
+
+	var clients sync.WaitGroup
+	for i := 0; i < n; i++ {
+		clients.Add(1)
+		go func(i int) {
+			defer clients.Done()
+			target := fmt.Sprintf("/users/%d/files/%d?q=%d", i, i, i)
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+			if w.Code != http.StatusAccepted {
+				errs <- fmt.Errorf("GET %s = %d", target, w.Code)
+			}
+		}(i)
+	}
+	clients.Wait()
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+type contextKey struct{}
+
+func TestContextDetach(t *testing.T) {
+	var copied, detached *Context
+	s := New()
+	s.Deadline(time.Second)
+	s.Get("/", func(ctx *Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("the context has no deadline")
+		}
+		copied, detached = ctx.Copy(), ctx.Detach()
+		return nil
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), contextKey{}, "v"))
+	s.ServeHTTP(httptest.NewRecorder(), r)
+
+	select {
+	case <-copied.Done():
+	default:
+		t.Error("the copy is not canceled after the request")
+	}
+	if _, ok := detached.Deadline(); ok || detached.Done() != nil || detached.Err() != nil {
+		t.Errorf("the detached context is canceled: %v", detached.Err())
+	}
+	if copied.Value(contextKey{}) != "v" || detached.Value(contextKey{}) != "v" {
+		t.Error("the copies lost the request context values")
+	}
+}
@@ -0,0 +1,137 @@
+package ws
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DecodeOptions are the options of decoding the request body by the codecs.
+type DecodeOptions struct {
+	// DisallowUnknownFields rejects the object keys or columns which do not match any field.
+	DisallowUnknownFields bool
+	// UseNumber decodes the JSON numbers into interface{} as json.Number.
+	UseNumber bool
+	// DisallowTrailingData rejects the data after the decoded value.
+	DisallowTrailingData bool
+	// RequireContentType rejects the request with a mismatched Content-Type by 415.
+	RequireContentType bool
+	// MaxBytes rejects the body larger than it by 413 if it is positive,
+	// it limits the request body for all the read paths, including the forms.
+	MaxBytes int64
+}
+
+// Decoding sets the decode options under the router, it is inherited by the routers below.
+func (a *Router) Decoding(opts DecodeOptions) *Router {
+	a.node.decodeOptions = &opts
+	return a
+}
+
+// decodeOptions returns the decode options of the deepest matched node which has one.
+func (a *Context) decodeOptions() DecodeOptions {
+	for k := len(a.matches) - 1; k >= 0; k-- {
+		if opts := a.matches[k].node.decodeOptions; opts != nil {
+			return *opts
+		}
+	}
+	return DecodeOptions{}
+}
+
+// checkContentType checks the Content-Type by the options.
+func (a *Context) checkContentType(opts DecodeOptions, mediaType string) error {
+	if opts.RequireContentType {
+		ct := a.Request.Header.Get("Content-Type")
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil || mediaFamily(mt) != mediaFamily(mediaType) {
+			return Status(http.StatusUnsupportedMediaType, ct)
+		}
+	}
+	return nil
+}
+
+// bodyError converts the error of reading the body to a 413 StatusError if the body is too large,
+// otherwise a 400 StatusError.
+func (a *Context) bodyError(err error) error {
+	if b, ok := a.Request.Body.(*bodyReader); ok && b.exceeded {
+		return Status(http.StatusRequestEntityTooLarge, err.Error()).Wrap(err)
+	}
+	return Status(http.StatusBadRequest, err.Error()).Wrap(err)
+}
+
+func decodeJSON(r io.Reader, opts DecodeOptions, value interface{}) error {
+	dec := json.NewDecoder(r)
+	if opts.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if opts.UseNumber {
+		dec.UseNumber()
+	}
+	if err := dec.Decode(value); err != nil {
+		return err
+	}
+	if opts.DisallowTrailingData {
+		if _, err := dec.Token(); err != io.EOF {
+			if err == nil {
+				err = errors.New("ws: trailing data after JSON value at offset " + strconv.FormatInt(dec.InputOffset(), 10))
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeXML(r io.Reader, opts DecodeOptions, value interface{}) error {
+	dec := xml.NewDecoder(r)
+	if err := dec.Decode(value); err != nil {
+		return err
+	}
+	if !opts.DisallowTrailingData {
+		return nil
+	}
+	for {
+		t, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := t.(type) {
+		case xml.Comment, xml.ProcInst:
+		case xml.CharData:
+			if len(strings.TrimSpace(string(t))) > 0 {
+				return errors.New("ws: trailing data after XML element at offset " + strconv.FormatInt(dec.InputOffset(), 10))
+			}
+		default:
+			return errors.New("ws: trailing data after XML element at offset " + strconv.FormatInt(dec.InputOffset(), 10))
+		}
+	}
+}
+
+// bodyReader limits the request body by http.MaxBytesReader, and records whether the limit is exceeded.
+type bodyReader struct {
+	io.ReadCloser
+	n        int64
+	exceeded bool
+}
+
+func newBodyReader(w http.ResponseWriter, body io.ReadCloser, n int64) *bodyReader {
+	return &bodyReader{
+		ReadCloser: http.MaxBytesReader(w, body, n),
+		n:          n,
+	}
+}
+
+func (a *bodyReader) Read(p []byte) (int, error) {
+	n, err := a.ReadCloser.Read(p)
+	a.n -= int64(n)
+	if err != nil && err != io.EOF && a.n <= 0 {
+		a.exceeded = true
+	}
+	return n, err
+}
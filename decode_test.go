@@ -0,0 +1,87 @@
+package ws
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDecodeOptions(t *testing.T) {
+	type body struct {
+		Name string `json:"name"`
+	}
+	s := New()
+	s.Route("/strict").Decoding(DecodeOptions{
+		DisallowUnknownFields: true,
+		DisallowTrailingData:  true,
+		RequireContentType:    true,
+		MaxBytes:              32,
+	}).Post("/", func(ctx *Context) error {
+		var b body
+		return ctx.ParseJSON(&b)
+	})
+	s.Post("/lenient", func(ctx *Context) error {
+		var b body
+		return ctx.ParseJSON(&b)
+	})
+
+	cases := []struct {
+		path string
+		ct   string
+		body string
+		code int
+	}{
+		{"/strict/", "application/json", `{"name":"a"}`, http.StatusOK},
+		{"/strict/", "application/problem+json", `{"name":"a"}`, http.StatusOK},
+		{"/strict/", "text/plain", `{"name":"a"}`, http.StatusUnsupportedMediaType},
+		{"/strict/", "application/json", `{"name":"a","x":1}`, http.StatusBadRequest},
+		{"/strict/", "application/json", `{"name":"a"} {}`, http.StatusBadRequest},
+		{"/strict/", "application/json", `{"name":"` + strings.Repeat("a", 64) + `"}`, http.StatusRequestEntityTooLarge},
+		{"/lenient", "text/plain", `{"name":"a","x":1} {}`, http.StatusOK},
+		{"/lenient", "application/json", `{"name":`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		w := serve(s, http.MethodPost, c.path, strings.NewReader(c.body), "Content-Type", c.ct)
+		if w.Code != c.code {
+			t.Errorf("POST %s %s %q = %d, want %d", c.path, c.ct, c.body, w.Code, c.code)
+		}
+	}
+}
+
+func TestDecodeMaxBytesForms(t *testing.T) {
+	type form struct {
+		Name string `form:"name"`
+	}
+	s := New()
+	s.Decoding(DecodeOptions{MaxBytes: 64})
+	s.Post("/bind", func(ctx *Context) error {
+		var f form
+		return ctx.Bind(&f)
+	})
+	s.Post("/file", func(ctx *Context) error {
+		_, _, err := ctx.FormFile("file")
+		return err
+	})
+
+	large := "name=" + strings.Repeat("a", 128)
+	if w := serve(s, http.MethodPost, "/bind", strings.NewReader(large), "Content-Type", "application/x-www-form-urlencoded"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large form = %d, want 413", w.Code)
+	}
+	if w := serve(s, http.MethodPost, "/bind", strings.NewReader("name=a"), "Content-Type", "application/x-www-form-urlencoded"); w.Code != http.StatusOK {
+		t.Errorf("small form = %d, want 200", w.Code)
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, _ := mw.CreateFormFile("file", "a.txt")
+	fw.Write(bytes.Repeat([]byte("a"), 256))
+	mw.Close()
+	for _, path := range []string{"/bind", "/file"} {
+		w := serve(s, http.MethodPost, path, bytes.NewReader(buf.Bytes()), "Content-Type", mw.FormDataContentType())
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("large multipart %s = %d, want 413", path, w.Code)
+		}
+	}
+}
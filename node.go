@@ -0,0 +1,318 @@
+package ws
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// node is the node of the radix tree.
+type node struct {
+	prefix      string
+	spec        string
+	check       func(string) bool
+	names       []string
+	middlewares []func(*Context) error
+	indices     string
+	statics     []*node
+	params      []*node
+	wild        *node
+	routes      map[string]*route
+
+	notFound         func(*Context) error
+	methodNotAllowed func(*Context) error
+	errorHandler     func(*Context, error)
+	decodeOptions    *DecodeOptions
+	deadline         time.Duration
+}
+
+type route struct {
+	name     string
+	pattern  string
+	names    []string
+	handlers []func(*Context) error
+}
+
+type match struct {
+	node  *node
+	path  string
+	value string
+	param bool
+}
+
+func newNode(names []string) *node {
+	return &node{
+		names:  names,
+		routes: make(map[string]*route),
+	}
+}
+
+// route finds the node by pattern, names are the param names before the pattern.
+func (a *node) route(pattern string, names []string) *node {
+	if len(pattern) < 1 || pattern[0] != '/' {
+		panic("ws: invalid router patttern: " + pattern)
+	}
+
+	n := a
+	for pattern != "" {
+		switch pattern[0] {
+		case ':':
+			i := strings.IndexByte(pattern, '/')
+			if i < 0 {
+				i = len(pattern)
+			}
+			name, spec := splitKey(pattern[:i])
+			names = append(names[:len(names):len(names)], name)
+			n = n.param(spec, names)
+			pattern = pattern[i:]
+		case '*':
+			if strings.IndexByte(pattern, '/') >= 0 {
+				panic("ws: wildcard must be the last segment: " + pattern)
+			}
+			name, spec := splitKey(pattern)
+			names = append(names[:len(names):len(names)], name)
+			if n.wild == nil {
+				n.wild = newNode(names)
+				n.wild.spec, n.wild.check = spec, constraint(spec)
+			} else if n.wild.spec != spec {
+				panic("ws: conflict between wildcard constraints " + n.wild.spec + " and " + spec)
+			}
+			n, pattern = n.wild, ""
+		default:
+			i := 1
+			for ; i < len(pattern); i++ {
+				if (pattern[i] == ':' || pattern[i] == '*') && pattern[i-1] == '/' {
+					break
+				}
+			}
+			n = n.static(pattern[:i], names)
+			pattern = pattern[i:]
+		}
+	}
+	return n
+}
+
+// static finds the static node by label, and splits the nodes if necessary.
+func (a *node) static(label string, names []string) *node {
+	for {
+		k := strings.IndexByte(a.indices, label[0])
+		if k < 0 {
+			n := newNode(names)
+			n.prefix = label
+			a.indices += label[:1]
+			a.statics = append(a.statics, n)
+			return n
+		}
+
+		n := a.statics[k]
+		l := 0
+		for l < len(label) && l < len(n.prefix) && label[l] == n.prefix[l] {
+			l++
+		}
+		if l < len(n.prefix) {
+			m := newNode(n.names)
+			m.prefix = n.prefix[:l]
+			n.prefix = n.prefix[l:]
+			m.indices = n.prefix[:1]
+			m.statics = []*node{n}
+			a.statics[k] = m
+			n = m
+		}
+		if l == len(label) {
+			return n
+		}
+		a, label = n, label[l:]
+	}
+}
+
+// param finds the parameter node by spec, the unconstrained one is always the last.
+func (a *node) param(spec string, names []string) *node {
+	for _, p := range a.params {
+		if p.spec == spec {
+			return p
+		}
+	}
+
+	n := newNode(names)
+	n.spec, n.check = spec, constraint(spec)
+	k := len(a.params)
+	if k > 0 && a.params[k-1].check == nil {
+		k--
+	}
+	a.params = append(a.params, nil)
+	copy(a.params[k+1:], a.params[k:])
+	a.params[k] = n
+	return n
+}
+
+// lookup appends the nodes matched by path to ms, and reports whether the path is matched completely.
+// The path is the rest after the node. Static children are tried first,
+// then the parameter children, and the wildcard child at last.
+// If the path is not matched completely, the deepest partial matches are returned.
+func (a *node) lookup(path string, ms []match) ([]match, bool) {
+	if path == "" && len(a.routes) > 0 {
+		return ms, true
+	}
+
+	var static *node
+	if path != "" {
+		if k := strings.IndexByte(a.indices, path[0]); k >= 0 && strings.HasPrefix(path, a.statics[k].prefix) {
+			static = a.statics[k]
+		}
+	}
+	best, bn := -1, len(ms)
+	if static != nil {
+		r, ok := static.enter(path[len(static.prefix):], "", ms)
+		if ok {
+			return r, true
+		}
+		if len(r) > bn {
+			best, bn = len(a.params), len(r)
+		}
+	}
+
+	seg, rest := path, ""
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		seg, rest = path[:i], path[i:]
+	}
+	for k, p := range a.params {
+		if p.check != nil && !p.check(seg) {
+			continue
+		}
+		r, ok := p.enter(rest, seg, ms)
+		if ok {
+			return r, true
+		}
+		if len(r) > bn {
+			best, bn = k, len(r)
+		}
+	}
+	if wild := a.wild; wild != nil && len(wild.routes) > 0 && (wild.check == nil || wild.check(path)) {
+		return append(ms, match{node: wild, value: path, param: true}), true
+	}
+
+	// the partial matches share the backing array, so the deepest one is looked up again.
+	switch {
+	case best < 0:
+		return ms, false
+	case best == len(a.params):
+		return static.enter(path[len(static.prefix):], "", ms)
+	default:
+		return a.params[best].enter(rest, seg, ms)
+	}
+}
+
+// enter appends the node to ms if the path is at a segment boundary, and looks up the path.
+// Only the parameter nodes have no prefix here.
+func (a *node) enter(path, value string, ms []match) ([]match, bool) {
+	param := a.prefix == ""
+	if param || path == "" || path[0] == '/' {
+		ms = append(ms, match{node: a, path: path, value: value, param: param})
+	}
+	return a.lookup(path, ms)
+}
+
+func notFound(n *node) func(*Context) error {
+	return n.notFound
+}
+
+func methodNotAllowed(n *node) func(*Context) error {
+	return n.methodNotAllowed
+}
+
+// walk calls fn for every route of the node and its children, mws are the middleware names before the node.
+// Like enter, the middlewares of the node apply to its routes and the static children at a segment boundary,
+// but not to the children which continue the segment, such as the parameters and "/api-docs" below "/api".
+func (a *node) walk(mws []string, fn func(RouteInfo) error) error {
+	own := mws
+	for _, h := range a.middlewares {
+		own = append(own[:len(own):len(own)], funcName(h))
+	}
+
+	methods := make([]string, 0, len(a.routes))
+	for m := range a.routes {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	for _, m := range methods {
+		r := a.routes[m]
+		err := fn(RouteInfo{
+			Name:        r.name,
+			Method:      m,
+			Pattern:     r.pattern,
+			Handlers:    len(r.handlers),
+			Middlewares: own,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, n := range a.statics {
+		next := mws
+		if n.prefix[0] == '/' {
+			next = own
+		}
+		if err := n.walk(next, fn); err != nil {
+			return err
+		}
+	}
+	for _, n := range a.params {
+		if err := n.walk(mws, fn); err != nil {
+			return err
+		}
+	}
+	if a.wild != nil {
+		return a.wild.walk(mws, fn)
+	}
+	return nil
+}
+
+// funcName returns the name of the function.
+func funcName(h func(*Context) error) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(h).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "unknown"
+}
+
+// params returns the params of matches for the method.
+func params(ms []match, method string) map[string]string {
+	names := routeNames(ms, method)
+	ps := make(map[string]string, len(names))
+	i := 0
+	for _, m := range ms {
+		if m.param && i < len(names) {
+			ps[names[i]] = m.value
+			i++
+		}
+	}
+	return ps
+}
+
+// routeNames returns the param names of matches for the method.
+func routeNames(ms []match, method string) []string {
+	n := ms[len(ms)-1].node
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	if r, ok := n.routes[method]; ok {
+		return r.names
+	}
+	return n.names
+}
+
+// paramNames returns the param names in pattern.
+func paramNames(pattern string) []string {
+	var names []string
+	for _, key := range strings.Split(pattern, "/") {
+		if len(key) > 0 && (key[0] == ':' || key[0] == '*') {
+			name, _ := splitKey(key)
+			names = append(names, name)
+		}
+	}
+	return names
+}
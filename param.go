@@ -0,0 +1,85 @@
+package ws
+
+import (
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidUUID is returned when parsing an invalid UUID.
+var ErrInvalidUUID = errors.New("ws: invalid uuid")
+
+// UUID is the universally unique identifier.
+type UUID [16]byte
+
+// ParseUUID parses the UUID in the form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, ErrInvalidUUID
+	}
+	j := 0
+	for i := 0; i < len(s); i += 2 {
+		if s[i] == '-' {
+			i++
+		}
+		if _, err := hex.Decode(u[j:j+1], []byte(s[i:i+2])); err != nil {
+			return u, ErrInvalidUUID
+		}
+		j++
+	}
+	return u, nil
+}
+
+// String returns the UUID in the form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx.
+func (a UUID) String() string {
+	var b [36]byte
+	hex.Encode(b[0:8], a[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], a[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], a[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], a[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], a[10:])
+	return string(b[:])
+}
+
+// splitKey splits the key like :name<spec> into name and spec.
+func splitKey(key string) (string, string) {
+	key = key[1:]
+	i := strings.IndexByte(key, '<')
+	if i < 0 {
+		return key, ""
+	}
+	if key[len(key)-1] != '>' {
+		panic("ws: invalid parameter constraint: " + key)
+	}
+	return key[:i], key[i+1 : len(key)-1]
+}
+
+// constraint returns the checker of the spec, which is int, uuid or regex:expr.
+func constraint(spec string) func(string) bool {
+	switch {
+	case spec == "":
+		return nil
+	case spec == "int":
+		return func(s string) bool {
+			_, err := strconv.ParseInt(s, 10, 64)
+			return err == nil
+		}
+	case spec == "uuid":
+		return func(s string) bool {
+			_, err := ParseUUID(s)
+			return err == nil
+		}
+	case strings.HasPrefix(spec, "regex:"):
+		re := regexp.MustCompile("^(?:" + spec[len("regex:"):] + ")$")
+		return re.MatchString
+	default:
+		panic("ws: unknown parameter constraint: " + spec)
+	}
+}
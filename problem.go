@@ -0,0 +1,151 @@
+package ws
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Problem is the problem details for HTTP APIs, see RFC 7807.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+// NewProblem creates a new problem with the title of the status code.
+func NewProblem(code int, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(code),
+		Status: code,
+		Detail: detail,
+	}
+}
+
+// Code returns the error code.
+func (a *Problem) Code() int {
+	if a.Status > 0 {
+		return a.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// Error returns the error string.
+func (a *Problem) Error() string {
+	s := "ws: problem(" + strconv.Itoa(a.Code()) + ") " + a.Title
+	if a.Detail != "" {
+		s += ": " + a.Detail
+	}
+	return s
+}
+
+// With sets the extension member.
+func (a *Problem) With(key string, value interface{}) *Problem {
+	if a.Extensions == nil {
+		a.Extensions = make(map[string]interface{})
+	}
+	a.Extensions[key] = value
+	return a
+}
+
+// MarshalJSON encodes the problem as JSON object, the extensions are the members of the object.
+func (a *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(a.Extensions)+5)
+	for k, v := range a.Extensions {
+		m[k] = v
+	}
+	if a.Type != "" {
+		m["type"] = a.Type
+	}
+	if a.Title != "" {
+		m["title"] = a.Title
+	}
+	if a.Status > 0 {
+		m["status"] = a.Status
+	}
+	if a.Detail != "" {
+		m["detail"] = a.Detail
+	}
+	if a.Instance != "" {
+		m["instance"] = a.Instance
+	}
+	return json.Marshal(m)
+}
+
+// MarshalXML encodes the problem as XML element in the namespace urn:ietf:rfc:7807.
+func (a *Problem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{
+		Name: xml.Name{Space: "urn:ietf:rfc:7807", Local: "problem"},
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	members := []struct {
+		key   string
+		value interface{}
+		ok    bool
+	}{
+		{"type", a.Type, a.Type != ""},
+		{"title", a.Title, a.Title != ""},
+		{"status", a.Status, a.Status > 0},
+		{"detail", a.Detail, a.Detail != ""},
+		{"instance", a.Instance, a.Instance != ""},
+	}
+	for _, m := range members {
+		if m.ok {
+			if err := e.EncodeElement(m.value, xml.StartElement{Name: xml.Name{Local: m.key}}); err != nil {
+				return err
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(a.Extensions))
+	for k := range a.Extensions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := e.EncodeElement(a.Extensions[k], xml.StartElement{Name: xml.Name{Local: k}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// Problem responses the problem as application/problem+json,
+// or application/problem+xml if the client prefers XML.
+func (a *Context) Problem(p *Problem) error {
+	var b []byte
+	var err error
+	header := a.ResponseWriter.Header()
+	if prefersXML(a.Request.Header.Get("Accept")) {
+		if b, err = xml.Marshal(p); err != nil {
+			return err
+		}
+		b = append([]byte(xml.Header), b...)
+		header.Set("Content-Type", "application/problem+xml; charset=utf-8")
+	} else {
+		if b, err = json.Marshal(p); err != nil {
+			return err
+		}
+		header.Set("Content-Type", "application/problem+json; charset=utf-8")
+	}
+	a.ResponseWriter.WriteHeader(p.Code())
+	a.ResponseWriter.Write(b)
+	return nil
+}
+
+// prefersXML reports whether the accept header prefers XML to JSON.
+func prefersXML(accept string) bool {
+	ranges := parseAccept(accept)
+	qjson := math.Max(acceptQuality(ranges, "application/problem+json"), acceptQuality(ranges, "application/json"))
+	qxml := math.Max(acceptQuality(ranges, "application/problem+xml"), acceptQuality(ranges, "application/xml"))
+	return qxml > qjson
+}
@@ -0,0 +1,135 @@
+package ws
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Render responses the value encoded by the codec which the client accepts best.
+// The acceptable codecs are tried in the order of quality, then the order of registration,
+// and the next one is used if the value cannot be encoded.
+// It returns a 406 StatusError if no codec is acceptable or can encode the value.
+func (a *Context) Render(value interface{}) error {
+	a.ResponseWriter.Header().Add("Vary", "Accept")
+
+	accept := a.Request.Header.Get("Accept")
+	var ranges []acceptRange
+	if accept != "" {
+		ranges = parseAccept(accept)
+	}
+	type offer struct {
+		mediaType string
+		codec     Codec
+		q         float64
+	}
+	offers := make([]offer, 0, len(codecs))
+	for _, e := range codecs {
+		q := 1.0
+		if ranges != nil {
+			q = acceptQuality(ranges, e.mediaType)
+		}
+		if q > 0 {
+			offers = append(offers, offer{e.mediaType, e.codec, q})
+		}
+	}
+	sort.SliceStable(offers, func(i, j int) bool {
+		return offers[i].q > offers[j].q
+	})
+
+	var errs []string
+	for _, o := range offers {
+		var buf bytes.Buffer
+		if err := o.codec.Encode(&buf, value); err != nil {
+			errs = append(errs, o.mediaType+": "+err.Error())
+			continue
+		}
+		a.write(o.mediaType, buf.Bytes())
+		return nil
+	}
+	text := accept
+	if len(errs) > 0 {
+		text += ": " + strings.Join(errs, "; ")
+	}
+	return Status(http.StatusNotAcceptable, text)
+}
+
+// Negotiate returns the offered media type which the client accepts best by the Accept header.
+// It returns the first offer if there is no Accept header, or an empty string if none is acceptable.
+func (a *Context) Negotiate(offers ...string) string {
+	accept := a.Request.Header.Get("Accept")
+	if accept == "" {
+		if len(offers) > 0 {
+			return offers[0]
+		}
+		return ""
+	}
+
+	ranges := parseAccept(accept)
+	best, bq := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(ranges, offer); q > bq {
+			best, bq = offer, q
+		}
+	}
+	return best
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses the Accept header into media ranges.
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, s := range strings.Split(accept, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		r := acceptRange{mediaType: s, q: 1}
+		if i := strings.IndexByte(s, ';'); i >= 0 {
+			r.mediaType = strings.TrimSpace(s[:i])
+			for _, p := range strings.Split(s[i+1:], ";") {
+				p = strings.TrimSpace(p)
+				if strings.HasPrefix(p, "q=") {
+					if q, err := strconv.ParseFloat(p[2:], 64); err == nil {
+						r.q = q
+					}
+				}
+			}
+		}
+		r.mediaType = strings.ToLower(r.mediaType)
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality of the media type by the most specific matched range.
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	mediaType = strings.ToLower(mediaType)
+	typ := mediaType
+	if i := strings.IndexByte(mediaType, '/'); i >= 0 {
+		typ = mediaType[:i]
+	}
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.mediaType == mediaType:
+			s = 2
+		case r.mediaType == typ+"/*":
+			s = 1
+		case r.mediaType == "*/*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
@@ -0,0 +1,72 @@
+package ws
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+type renderItem struct {
+	Name string `json:"name" xml:"name"`
+}
+
+func TestRender(t *testing.T) {
+	s := New()
+	s.Get("/map", func(ctx *Context) error {
+		return ctx.Render(map[string]int{"a": 1})
+	})
+	s.Get("/struct", func(ctx *Context) error {
+		return ctx.Render(renderItem{"x"})
+	})
+
+	cases := []struct {
+		path   string
+		accept string
+		code   int
+		ct     string
+	}{
+		{"/map", "", http.StatusOK, "application/json"},
+		{"/map", "*/*", http.StatusOK, "application/json"},
+		{"/map", browserAccept, http.StatusOK, "application/json"},
+		{"/struct", browserAccept, http.StatusOK, "application/xml"},
+		{"/struct", "application/xml, application/json;q=0.5", http.StatusOK, "application/xml"},
+		{"/struct", "application/json;q=0.5, application/xml;q=0.8", http.StatusOK, "application/xml"},
+		{"/struct", "text/*", http.StatusOK, "text/plain"},
+		{"/map", "application/xml", http.StatusNotAcceptable, ""},
+		{"/map", "image/png", http.StatusNotAcceptable, ""},
+		{"/struct", "application/json;q=0", http.StatusNotAcceptable, ""},
+	}
+	for _, c := range cases {
+		w := serve(s, http.MethodGet, c.path, nil, "Accept", c.accept)
+		ct := w.Header().Get("Content-Type")
+		if w.Code != c.code || !strings.HasPrefix(ct, c.ct) {
+			t.Errorf("GET %s Accept %q = %d %q, want %d %q", c.path, c.accept, w.Code, ct, c.code, c.ct)
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("GET %s Accept %q: missing Vary", c.path, c.accept)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := []struct {
+		accept string
+		offers []string
+		want   string
+	}{
+		{"", []string{"a/b", "c/d"}, "a/b"},
+		{"c/d", []string{"a/b", "c/d"}, "c/d"},
+		{"*/*", []string{"a/b", "c/d"}, "a/b"},
+		{"a/*;q=0.5, c/d", []string{"a/b", "c/d"}, "c/d"},
+		{"a/b;q=0, */*", []string{"a/b", "c/d"}, "c/d"},
+		{"x/y", []string{"a/b", "c/d"}, ""},
+	}
+	for _, c := range cases {
+		ctx := &Context{Request: &http.Request{Header: http.Header{"Accept": {c.accept}}}}
+		if got := ctx.Negotiate(c.offers...); got != c.want {
+			t.Errorf("Negotiate(%q, %q) = %q, want %q", c.accept, c.offers, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package ws
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// Response wraps the http.ResponseWriter to record the status code, the body size and whether the header is written.
+// The response writer of the context implements http.Flusher, http.Hijacker and http.Pusher
+// only if the wrapped writer does, and they are routed through the Response.
+type Response struct {
+	http.ResponseWriter
+	status   int
+	size     int64
+	written  bool
+	hijacked bool
+	ctx      *Context
+}
+
+func (a *Response) reset(w http.ResponseWriter) {
+	*a = Response{ResponseWriter: w, ctx: a.ctx}
+}
+
+// Status returns the written status code, or 0 if the header has not been written.
+// It returns the status code to be written in the before-write hooks.
+func (a *Response) Status() int {
+	return a.status
+}
+
+// Size returns the number of the written body bytes.
+func (a *Response) Size() int64 {
+	return a.size
+}
+
+// Written reports whether the header has been written or the connection has been hijacked.
+func (a *Response) Written() bool {
+	return a.written
+}
+
+// Unwrap returns the wrapped writer.
+func (a *Response) Unwrap() http.ResponseWriter {
+	return a.ResponseWriter
+}
+
+// WriteHeader calls the before-write hooks and writes the header with the status code,
+// the superfluous calls are ignored.
+func (a *Response) WriteHeader(code int) {
+	if a.written {
+		return
+	}
+	a.status = code
+	if a.ctx != nil {
+		a.ctx.beforeWrite()
+		if a.written {
+			return
+		}
+	}
+	a.written = true
+	a.ResponseWriter.WriteHeader(code)
+}
+
+func (a *Response) Write(b []byte) (int, error) {
+	if a.hijacked {
+		return 0, http.ErrHijacked
+	}
+	a.WriteHeader(http.StatusOK)
+	n, err := a.ResponseWriter.Write(b)
+	a.size += int64(n)
+	return n, err
+}
+
+// ReadFrom copies the body from r, it uses the wrapped writer's ReadFrom if it has one.
+func (a *Response) ReadFrom(r io.Reader) (int64, error) {
+	if a.hijacked {
+		return 0, http.ErrHijacked
+	}
+	a.WriteHeader(http.StatusOK)
+	var n int64
+	var err error
+	if rf, ok := a.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(struct{ io.Writer }{a.ResponseWriter}, r)
+	}
+	a.size += n
+	return n, err
+}
+
+func (a *Response) flush() {
+	if a.hijacked {
+		return
+	}
+	a.WriteHeader(http.StatusOK)
+	a.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (a *Response) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := a.ResponseWriter.(http.Hijacker).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	a.written = true
+	a.hijacked = true
+	return conn, brw, nil
+}
+
+func (a *Response) push(target string, opts *http.PushOptions) error {
+	return a.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// writer returns the response writer which implements the optional interfaces of the wrapped writer.
+// The wrappers hold only the pointer, so converting them to the interface does not allocate.
+func (a *Response) writer() http.ResponseWriter {
+	_, f := a.ResponseWriter.(http.Flusher)
+	_, h := a.ResponseWriter.(http.Hijacker)
+	_, p := a.ResponseWriter.(http.Pusher)
+	switch {
+	case f && h && p:
+		return responseFHP{a}
+	case f && h:
+		return responseFH{a}
+	case f && p:
+		return responseFP{a}
+	case h && p:
+		return responseHP{a}
+	case f:
+		return responseF{a}
+	case h:
+		return responseH{a}
+	case p:
+		return responseP{a}
+	}
+	return a
+}
+
+type responseF struct{ *Response }
+
+func (a responseF) Flush() { a.flush() }
+
+type responseH struct{ *Response }
+
+func (a responseH) Hijack() (net.Conn, *bufio.ReadWriter, error) { return a.hijack() }
+
+type responseP struct{ *Response }
+
+func (a responseP) Push(target string, opts *http.PushOptions) error { return a.push(target, opts) }
+
+type responseFH struct{ *Response }
+
+func (a responseFH) Flush()                                       { a.flush() }
+func (a responseFH) Hijack() (net.Conn, *bufio.ReadWriter, error) { return a.hijack() }
+
+type responseFP struct{ *Response }
+
+func (a responseFP) Flush()                                           { a.flush() }
+func (a responseFP) Push(target string, opts *http.PushOptions) error { return a.push(target, opts) }
+
+type responseHP struct{ *Response }
+
+func (a responseHP) Hijack() (net.Conn, *bufio.ReadWriter, error)     { return a.hijack() }
+func (a responseHP) Push(target string, opts *http.PushOptions) error { return a.push(target, opts) }
+
+type responseFHP struct{ *Response }
+
+func (a responseFHP) Flush()                                           { a.flush() }
+func (a responseFHP) Hijack() (net.Conn, *bufio.ReadWriter, error)     { return a.hijack() }
+func (a responseFHP) Push(target string, opts *http.PushOptions) error { return a.push(target, opts) }
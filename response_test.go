@@ -0,0 +1,170 @@
+package ws
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// hijackWriter is a response writer which supports flushing and hijacking, but not pushing.
+type hijackWriter struct {
+	discardWriter
+	flushed  int
+	hijacked bool
+}
+
+func (a *hijackWriter) Flush() {
+	a.flushed++
+}
+
+func (a *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	a.hijacked = true
+	return nil, nil, nil
+}
+
+func TestResponseInterfaces(t *testing.T) {
+	type check struct {
+		flusher, hijacker, pusher bool
+	}
+	var got check
+	s := New()
+	s.Get("/", func(ctx *Context) error {
+		_, got.flusher = ctx.ResponseWriter.(http.Flusher)
+		_, got.hijacker = ctx.ResponseWriter.(http.Hijacker)
+		_, got.pusher = ctx.ResponseWriter.(http.Pusher)
+		return nil
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	for _, c := range []struct {
+		w    http.ResponseWriter
+		want check
+	}{
+		{&discardWriter{header: make(http.Header)}, check{}},
+		{httptest.NewRecorder(), check{flusher: true}},
+		{&hijackWriter{discardWriter: discardWriter{header: make(http.Header)}}, check{flusher: true, hijacker: true}},
+	} {
+		got = check{}
+		s.ServeHTTP(c.w, r)
+		if got != c.want {
+			t.Errorf("%T: interfaces = %+v, want %+v", c.w, got, c.want)
+		}
+	}
+}
+
+func TestResponseRecord(t *testing.T) {
+	var status int
+	var size int64
+	s := New()
+	s.Get("/", func(ctx *Context) error {
+		ctx.BeforeWrite(func(ctx *Context) {
+			ctx.ResponseWriter.Header().Set("X-Status", http.StatusText(ctx.Response().Status()))
+		})
+		ctx.AfterResponse(func(ctx *Context) {
+			status, size = ctx.Response().Status(), ctx.Response().Size()
+		})
+		ctx.ResponseWriter.WriteHeader(http.StatusCreated)
+		ctx.ResponseWriter.WriteHeader(http.StatusAccepted)
+		ctx.ResponseWriter.Write([]byte("hello"))
+		ctx.ResponseWriter.(http.Flusher).Flush()
+		return nil
+	})
+	w := serve(s, http.MethodGet, "/", nil)
+	if w.Code != http.StatusCreated || w.Header().Get("X-Status") != "Created" || !w.Flushed {
+		t.Errorf("GET / = %d %q flushed %v", w.Code, w.Header().Get("X-Status"), w.Flushed)
+	}
+	if status != http.StatusCreated || size != 5 {
+		t.Errorf("Response = %d %d, want 201 5", status, size)
+	}
+}
+
+func TestResponseHijack(t *testing.T) {
+	var written bool
+	var err error
+	s := New()
+	s.Get("/", func(ctx *Context) error {
+		if _, _, err := ctx.Hijack(); err != nil {
+			return err
+		}
+		ctx.BeforeWrite(func(ctx *Context) {
+			t.Error("before-write hook is called after hijacking")
+		})
+		written = ctx.Written()
+		_, err = ctx.ResponseWriter.Write([]byte("x"))
+		ctx.ResponseWriter.(http.Flusher).Flush()
+		return nil
+	})
+	w := &hijackWriter{discardWriter: discardWriter{header: make(http.Header)}}
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !w.hijacked || !written || err != http.ErrHijacked || w.flushed != 0 {
+		t.Errorf("Hijack = %v, Written = %v, Write = %v, flushed %d", w.hijacked, written, err, w.flushed)
+	}
+
+	rec := serve(s, http.MethodGet, "/", nil)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Hijack without support = %d, want 500", rec.Code)
+	}
+}
+
+func TestResponseZeroAllocs(t *testing.T) {
+	s := New()
+	s.Get("/users/:id", func(ctx *Context) error {
+		ctx.ResponseWriter.(http.Flusher).Flush()
+		return nil
+	})
+	w := &hijackWriter{discardWriter: discardWriter{header: make(http.Header)}}
+	r := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	if n := testing.AllocsPerRun(100, func() {
+		s.ServeHTTP(w, r)
+	}); n != 0 {
+		t.Errorf("allocs = %v, want 0", n)
+	}
+}
+
+func TestResponseHooks(t *testing.T) {
+	var trace []string
+	s := New()
+	s.ErrorHandler(func(ctx *Context, err error) {
+		trace = append(trace, "error")
+		DefaultErrorHandler(ctx, err)
+	})
+	s.Use(func(ctx *Context) error {
+		ctx.BeforeWrite(func(ctx *Context) {
+			trace = append(trace, "before 1")
+			ctx.ResponseWriter.Header().Set("X-Before", "1")
+		})
+		ctx.AfterResponse(func(ctx *Context) {
+			trace = append(trace, "after 1 "+http.StatusText(ctx.Response().Status()))
+		})
+		return ctx.Next()
+	})
+	s.Get("/", func(ctx *Context) error {
+		ctx.BeforeWrite(func(ctx *Context) {
+			trace = append(trace, "before 2")
+		})
+		ctx.AfterResponse(func(ctx *Context) {
+			trace = append(trace, "after 2")
+		})
+		if ctx.Query("fail") != "" {
+			return Status(http.StatusBadRequest, "bad")
+		}
+		trace = append(trace, "handler")
+		return ctx.Text("ok")
+	})
+
+	w := serve(s, http.MethodGet, "/", nil)
+	want := []string{"handler", "before 2", "before 1", "after 2", "after 1 OK"}
+	if !reflect.DeepEqual(trace, want) || w.Header().Get("X-Before") != "1" {
+		t.Errorf("trace = %q, want %q", trace, want)
+	}
+
+	trace = nil
+	w = serve(s, http.MethodGet, "/?fail=1", nil)
+	want = []string{"error", "before 2", "before 1", "after 2", "after 1 Bad Request"}
+	if !reflect.DeepEqual(trace, want) || w.Code != http.StatusBadRequest || w.Header().Get("X-Before") != "1" {
+		t.Errorf("trace = %q, want %q", trace, want)
+	}
+}
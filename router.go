@@ -1,32 +1,132 @@
 package ws
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"time"
 )
 
 // Router is the router.
 type Router struct {
-	key         string
-	middlewares []func(*Context) error
-	children    map[string]*Router
-	handlers    map[string][]func(*Context) error
+	node   *node
+	prefix string
+	named  map[string]*route
+	last   *route
+
+	shutdown chan struct{}
 }
 
 // Use uses the middlewares.
 func (a *Router) Use(hs ...func(*Context) error) *Router {
-	a.middlewares = append(a.middlewares, hs...)
+	a.node.middlewares = append(a.node.middlewares, hs...)
+	return a
+}
+
+// NotFound sets the handler for the paths not found under the router.
+// It is inherited by the routers below, and runs after the middlewares.
+func (a *Router) NotFound(h func(*Context) error) *Router {
+	a.node.notFound = h
+	return a
+}
+
+// MethodNotAllowed sets the handler for the methods not allowed under the router.
+// It is inherited by the routers below, and runs after the middlewares.
+func (a *Router) MethodNotAllowed(h func(*Context) error) *Router {
+	a.node.methodNotAllowed = h
+	return a
+}
+
+// ErrorHandler sets the handler for the errors returned under the router.
+// It is inherited by the routers below, and the default one is DefaultErrorHandler.
+func (a *Router) ErrorHandler(h func(*Context, error)) *Router {
+	a.node.errorHandler = h
+	return a
+}
+
+// Deadline sets the deadline of the request contexts under the router, which is d after the request is routed.
+// It is inherited by the routers below, and the deepest one is used.
+func (a *Router) Deadline(d time.Duration) *Router {
+	a.node.deadline = d
 	return a
 }
 
 // Handle registers the handler for the given pattern and method.
 func (a *Router) Handle(method string, pattern string, hs ...func(*Context) error) *Router {
-	r := a.Route(pattern)
-	r.handlers[method] = append(r.handlers[method], hs...)
+	n := a.node.route(pattern, paramNames(a.prefix))
+	pattern = a.prefix + pattern
+	names := paramNames(pattern)
+	r, ok := n.routes[method]
+	if !ok {
+		r = &route{
+			pattern: pattern,
+			names:   names,
+		}
+		n.routes[method] = r
+	} else if strings.Join(r.names, "/") != strings.Join(names, "/") {
+		panic("ws: conflict between patterns " + r.pattern + " and " + pattern)
+	}
+	r.handlers = append(r.handlers, hs...)
+	a.last = r
+	return a
+}
+
+// Name names the route registered last by the router, the name is used to build the URL.
+func (a *Router) Name(name string) *Router {
+	if a.last == nil {
+		panic("ws: no route to name " + name)
+	}
+	if r, ok := a.named[name]; ok && r != a.last {
+		panic("ws: conflict between route names of " + r.pattern + " and " + a.last.pattern)
+	}
+	a.last.name = name
+	a.named[name] = a.last
 	return a
 }
 
+// URL builds the URL of the named route, pairs are the param keys and values.
+func (a *Router) URL(name string, pairs ...string) (string, error) {
+	r, ok := a.named[name]
+	if !ok {
+		return "", errors.New("ws: unknown route name: " + name)
+	}
+	if len(pairs)%2 != 0 {
+		return "", errors.New("ws: odd number of params for route " + name)
+	}
+
+	keys := strings.Split(r.pattern, "/")
+	for i, key := range keys {
+		if len(key) < 1 || (key[0] != ':' && key[0] != '*') {
+			continue
+		}
+		pname, _ := splitKey(key)
+		value, ok := "", false
+		for j := 0; j < len(pairs); j += 2 {
+			if pairs[j] == pname {
+				value, ok = pairs[j+1], true
+				break
+			}
+		}
+		if !ok {
+			return "", errors.New("ws: missing param " + pname + " for route " + name)
+		}
+		if key[0] == ':' {
+			keys[i] = url.PathEscape(value)
+			continue
+		}
+		segs := strings.Split(value, "/")
+		for k, seg := range segs {
+			segs[k] = url.PathEscape(seg)
+		}
+		keys[i] = strings.Join(segs, "/")
+	}
+	return strings.Join(keys, "/"), nil
+}
+
 // Get registers the handler for the given pattern and method GET.
 func (a *Router) Get(pattern string, hs ...func(*Context) error) *Router {
 	return a.Handle(http.MethodGet, pattern, hs...)
@@ -54,90 +154,116 @@ func (a *Router) Delete(pattern string, hs ...func(*Context) error) *Router {
 
 // Route finds the router by pattern.
 func (a *Router) Route(pattern string) *Router {
-	if len(pattern) < 1 || pattern[0] != '/' {
-		panic("ws: invalid router patttern: " + pattern)
-	}
-	pattern = pattern[1:]
-	i := strings.IndexRune(pattern, '/')
-
-	var key string
-	if i < 0 {
-		key = pattern
-	} else {
-		key = pattern[:i]
-	}
+	return &Router{
+		node:   a.node.route(pattern, paramNames(a.prefix)),
+		prefix: a.prefix + pattern,
+		named:  a.named,
 
-	router, ok := a.children[key]
-	if !ok {
-		router = &Router{
-			children: make(map[string]*Router),
-			handlers: make(map[string][]func(*Context) error),
-		}
-		if len(key) > 0 && key[0] == ':' {
-			if a.key != "" {
-				panic("ws: conflict between parameters " + a.key + " and " + key)
-			}
-			a.key = key
-		}
-		a.children[key] = router
+		shutdown: a.shutdown,
 	}
-
-	if i < 0 {
-		return router
-	}
-	return router.Route(pattern[i:])
 }
 
-// Match matches the path.
-func (a *Router) Match(path string) (*Router, string, string) {
-	if len(path) < 1 || path[0] != '/' {
-		return nil, "", ""
+// Match matches the method and path, and returns the pattern of the matched route and its params.
+// It returns an empty pattern if no route matches.
+func (a *Router) Match(method, path string) (string, map[string]string) {
+	ms, ok := a.node.lookup(path, []match{{node: a.node, path: path}})
+	if !ok {
+		return "", nil
 	}
-	path = path[1:]
-	i := strings.IndexRune(path, '/')
-
-	var key, param string
-	if i < 0 {
-		key, path = path, ""
-	} else {
-		key, path = path[:i], path[i:]
+	if method == http.MethodHead {
+		method = http.MethodGet
 	}
-	if a.key != "" {
-		key, param = a.key, key
+	r, ok := ms[len(ms)-1].node.routes[method]
+	if !ok {
+		return "", nil
 	}
-	return a.children[key], path, param
+	return r.pattern, params(ms, method)
+}
+
+// RouteInfo is the information of a route.
+type RouteInfo struct {
+	Name        string
+	Method      string
+	Pattern     string
+	Handlers    int
+	Middlewares []string
+}
+
+// Routes returns the routes registered on the router, sorted by pattern and method.
+func (a *Router) Routes() []RouteInfo {
+	var rs []RouteInfo
+	a.Walk(func(r RouteInfo) error {
+		rs = append(rs, r)
+		return nil
+	})
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].Pattern != rs[j].Pattern {
+			return rs[i].Pattern < rs[j].Pattern
+		}
+		return rs[i].Method < rs[j].Method
+	})
+	return rs
+}
+
+// Walk calls fn for every route registered on the router, and stops if fn returns an error.
+// The middlewares of a route are the names of the middlewares from the router down to the route.
+func (a *Router) Walk(fn func(RouteInfo) error) error {
+	return a.node.walk(nil, fn)
 }
 
 // ServeHTTP dispatches the request to the handler whose pattern matches the request URL.
 func (a *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	if len(path) < 1 || path[0] != '/' {
+		path = "/" + path
+	}
+
+	ctx := ctxPool.Get().(*Context)
+	defer ctxPool.Put(ctx)
+	ctx.Request = r
+	ctx.response.reset(w)
+	ctx.ResponseWriter = ctx.response.writer()
+	ctx.router = a
+	ctx.Path = path
+	ctx.code = 0
+	ctx.before = nil
+	ctx.after = ctx.after[:0]
+	for k := range ctx.datas {
+		delete(ctx.datas, k)
+	}
+	ctx.querys = nil
+	ctx.matches = append(ctx.matches[:0], match{node: a.node, path: path})
+	ctx.names = nil
+	ctx.depth = 0
+	ctx.index = 0
+
+	defer ctx.afterResponse()
 	var err error
 	defer func() {
 		if x := recover(); x != nil {
 			err = fmt.Errorf("ws: %v", x)
 		}
-		finally(w, err)
+		if err != nil {
+			ctx.errorHandler()(ctx, err)
+		}
+		// write the implicit header by the wrapper to call the before-write hooks.
+		ctx.response.WriteHeader(http.StatusOK)
 	}()
 
-	path := r.URL.Path
-	if len(path) < 1 || path[0] != '/' {
-		path = "/" + path
-	}
 	if r.Method == http.MethodOptions && path == "/*" {
 		w.Header().Add("Allow", allAllow)
 		err = Status(http.StatusOK, "")
 		return
 	}
-
-	ctx := ctxPool.Get().(*Context)
-	defer ctxPool.Put(ctx)
-	ctx.Request = r
-	ctx.ResponseWriter = w
-	ctx.Path = path
-	ctx.code = 0
-	ctx.datas = make(map[string]interface{})
-	ctx.params = make(map[string]string)
-	ctx.querys = nil
-	ctx.router = a
-	ctx.index = -len(a.middlewares)
+	ctx.matches, _ = a.node.lookup(path, ctx.matches)
+	ctx.names = routeNames(ctx.matches, r.Method)
+	if n := ctx.decodeOptions().MaxBytes; n > 0 && r.Body != nil && r.Body != http.NoBody {
+		r.Body = newBodyReader(w, r.Body, n)
+	}
+	if d := ctx.deadline(); d > 0 {
+		var c context.Context
+		c, ctx.cancel = context.WithTimeout(r.Context(), d)
+		ctx.Request = r.WithContext(c)
+	}
 	err = ctx.Next()
 }
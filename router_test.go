@@ -0,0 +1,326 @@
+package ws
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// serve serves the request by h, and returns the recorded response.
+func serve(h http.Handler, method, target string, body io.Reader, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, body)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRouterMixedTree(t *testing.T) {
+	s := New()
+	for _, p := range []string{
+		"/users",
+		"/users/me",
+		"/users/me/settings",
+		"/users/:id",
+		"/users/:id/posts",
+		"/users/:id/posts/:pid",
+		"/users/new/posts/latest",
+		"/files/*path",
+		"/files/readme",
+		"/teams/:team/*rest",
+		"/teams/:team/members",
+		"/items/:id<int>",
+		"/items/:slug",
+		"/a/b/c",
+		"/a/:x/d",
+		"/a/*rest",
+	} {
+		s.Get(p, func(*Context) error { return nil })
+	}
+
+	cases := []struct {
+		path    string
+		pattern string
+		params  map[string]string
+	}{
+		{"/users", "/users", map[string]string{}},
+		{"/users/me", "/users/me", map[string]string{}},
+		{"/users/me/settings", "/users/me/settings", map[string]string{}},
+		{"/users/42", "/users/:id", map[string]string{"id": "42"}},
+		{"/users/meow", "/users/:id", map[string]string{"id": "meow"}},
+		{"/users/me/posts", "/users/:id/posts", map[string]string{"id": "me"}},
+		{"/users/new/posts/latest", "/users/new/posts/latest", map[string]string{}},
+		{"/users/new/posts/7", "/users/:id/posts/:pid", map[string]string{"id": "new", "pid": "7"}},
+		{"/files/readme", "/files/readme", map[string]string{}},
+		{"/files/readme.md", "/files/*path", map[string]string{"path": "readme.md"}},
+		{"/files/a/b/c", "/files/*path", map[string]string{"path": "a/b/c"}},
+		{"/teams/go/members", "/teams/:team/members", map[string]string{"team": "go"}},
+		{"/teams/go/members/x", "/teams/:team/*rest", map[string]string{"team": "go", "rest": "members/x"}},
+		{"/items/12", "/items/:id<int>", map[string]string{"id": "12"}},
+		{"/items/abc", "/items/:slug", map[string]string{"slug": "abc"}},
+		{"/a/b/c", "/a/b/c", map[string]string{}},
+		{"/a/b/d", "/a/:x/d", map[string]string{"x": "b"}},
+		{"/a/b/e", "/a/*rest", map[string]string{"rest": "b/e"}},
+		{"/nope", "", nil},
+		{"/users/42/comments", "", nil},
+	}
+	for _, c := range cases {
+		pattern, params := s.Match(http.MethodGet, c.path)
+		if pattern != c.pattern || !reflect.DeepEqual(params, c.params) {
+			t.Errorf("Match(%q) = %q %v, want %q %v", c.path, pattern, params, c.pattern, c.params)
+		}
+	}
+}
+
+func TestRouterDispatch(t *testing.T) {
+	s := New()
+	var got string
+	s.Get("/users/me", func(ctx *Context) error {
+		got = "me"
+		return nil
+	})
+	s.Get("/users/:id", func(ctx *Context) error {
+		got = "user " + ctx.Param("id")
+		return nil
+	})
+	s.Get("/static/*path", func(ctx *Context) error {
+		got = "static " + ctx.Param("path")
+		return nil
+	})
+
+	for path, want := range map[string]string{
+		"/users/me":         "me",
+		"/users/7":          "user 7",
+		"/static/css/a.css": "static css/a.css",
+	} {
+		got = ""
+		if w := serve(s, http.MethodGet, path, nil); w.Code != http.StatusOK || got != want {
+			t.Errorf("GET %s = %d %q, want 200 %q", path, w.Code, got, want)
+		}
+	}
+
+	if w := serve(s, http.MethodGet, "/missing", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET /missing = %d, want 404", w.Code)
+	}
+	if w := serve(s, http.MethodPost, "/users/7", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /users/7 = %d, want 405", w.Code)
+	}
+	if w := serve(s, http.MethodOptions, "/users/7", nil); w.Code != http.StatusOK || w.Header().Get("Allow") == "" {
+		t.Errorf("OPTIONS /users/7 = %d %q, want 200 with Allow", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestRouterMiddlewares(t *testing.T) {
+	s := New()
+	var trace []string
+	mw := func(name string) func(*Context) error {
+		return func(ctx *Context) error {
+			trace = append(trace, name+" "+ctx.Path)
+			return ctx.Next()
+		}
+	}
+	s.Use(mw("root"))
+	api := s.Route("/api").Use(mw("api"))
+	api.Route("/users").Use(mw("users")).Get("/:id", func(ctx *Context) error {
+		trace = append(trace, "handler "+ctx.Param("id"))
+		return nil
+	})
+
+	serve(s, http.MethodGet, "/api/users/3", nil)
+	want := []string{"root /api/users/3", "api /users/3", "users /3", "handler 3"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Errorf("trace = %q, want %q", trace, want)
+	}
+}
+
+func TestRouterURL(t *testing.T) {
+	s := New()
+	s.Get("/users/:id/posts/:pid", func(*Context) error { return nil }).Name("post")
+	u, err := s.URL("post", "id", "a b", "pid", "7")
+	if err != nil || u != "/users/a%20b/posts/7" {
+		t.Errorf("URL = %q %v", u, err)
+	}
+	if _, err := s.URL("post", "id", "1"); err == nil {
+		t.Error("URL with missing param succeeded")
+	}
+}
+
+func TestRouterConflicts(t *testing.T) {
+	for name, fn := range map[string]func(){
+		"wildcard not last": func() { New().Get("/a/*x/b", nil) },
+		"param names":       func() { s := New(); s.Get("/a/:x", nil); s.Get("/a/:y", nil) },
+		"constraint":        func() { New().Get("/a/:x<nope>", nil) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+var walkTrace []string
+
+func walkLog(ctx *Context) error {
+	walkTrace = append(walkTrace, funcName(walkLog))
+	return ctx.Next()
+}
+
+func walkAuth(ctx *Context) error {
+	walkTrace = append(walkTrace, funcName(walkAuth))
+	return ctx.Next()
+}
+
+func walkFiles(ctx *Context) error {
+	walkTrace = append(walkTrace, funcName(walkFiles))
+	return ctx.Next()
+}
+
+func TestRouterRoutes(t *testing.T) {
+	h := func(*Context) error { return nil }
+	s := New()
+	s.Use(walkLog)
+	api := s.Route("/api").Use(walkAuth)
+	api.Get("/x", h).Name("x")
+	api.Post("/x", h, h)
+	s.Get("/api-docs", h)
+	s.Route("/files").Use(walkFiles).Get("/:name", h)
+	s.Get("/files/:name/raw", h)
+	s.Get("/static/*path", h)
+
+	paths := map[string]string{
+		"/api/x":           "/api/x",
+		"/api-docs":        "/api-docs",
+		"/files/:name":     "/files/a",
+		"/files/:name/raw": "/files/a/raw",
+		"/static/*path":    "/static/a/b",
+	}
+	routes := s.Routes()
+	if len(routes) != 6 {
+		t.Fatalf("Routes = %+v, want 6 routes", routes)
+	}
+	for _, r := range routes {
+		walkTrace = nil
+		if w := serve(s, r.Method, paths[r.Pattern], nil); w.Code != http.StatusOK && w.Code != http.StatusCreated {
+			t.Errorf("%s %s = %d", r.Method, paths[r.Pattern], w.Code)
+		}
+		if !reflect.DeepEqual(r.Middlewares, walkTrace) {
+			t.Errorf("%s %s: Middlewares = %q, but %q run", r.Method, r.Pattern, r.Middlewares, walkTrace)
+		}
+	}
+
+	want := RouteInfo{Name: "x", Method: http.MethodGet, Pattern: "/api/x", Handlers: 1, Middlewares: []string{funcName(walkLog), funcName(walkAuth)}}
+	if !reflect.DeepEqual(routes[1], want) || routes[0].Pattern != "/api-docs" || len(routes[0].Middlewares) != 1 {
+		t.Errorf("Routes = %+v", routes[:3])
+	}
+
+	n := 0
+	stop := errors.New("stop")
+	if err := s.Walk(func(RouteInfo) error { n++; return stop }); err != stop || n != 1 {
+		t.Errorf("Walk = %v after %d routes, want stop after 1", err, n)
+	}
+}
+
+func TestRouterHooks(t *testing.T) {
+	var trace []string
+	mw := func(name string) func(*Context) error {
+		return func(ctx *Context) error {
+			trace = append(trace, name)
+			return ctx.Next()
+		}
+	}
+	hook := func(name string, code int) func(*Context) error {
+		return func(ctx *Context) error {
+			// Next of the hook returns the error which it replaces.
+			trace = append(trace, name+" "+strconv.Itoa(ErrorCode(ctx.Next())))
+			ctx.Status(code)
+			return ctx.Text(name)
+		}
+	}
+	h := func(*Context) error { return nil }
+	s := New()
+	s.Use(mw("root"))
+	api := s.Route("/api").Use(mw("api")).
+		NotFound(hook("not found", http.StatusNotFound)).
+		MethodNotAllowed(hook("not allowed", http.StatusMethodNotAllowed))
+	api.Get("/x", h)
+	api.Route("/v1").Use(mw("v1")).Get("/y", h)
+	s.Get("/apix", h)
+
+	cases := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+		trace  []string
+	}{
+		{http.MethodGet, "/api/missing", http.StatusNotFound, "not found", []string{"root", "api", "not found 404"}},
+		{http.MethodGet, "/api/v1/missing", http.StatusNotFound, "not found", []string{"root", "api", "v1", "not found 404"}},
+		{http.MethodPost, "/api/x", http.StatusMethodNotAllowed, "not allowed", []string{"root", "api", "not allowed 405"}},
+		{http.MethodPost, "/api/v1/y", http.StatusMethodNotAllowed, "not allowed", []string{"root", "api", "v1", "not allowed 405"}},
+		{http.MethodGet, "/apix/missing", http.StatusNotFound, "Not Found\n", []string{"root"}},
+		{http.MethodPost, "/apix", http.StatusMethodNotAllowed, "Method Not Allowed\n", []string{"root"}},
+	}
+	for _, c := range cases {
+		trace = nil
+		w := serve(s, c.method, c.path, nil)
+		if w.Code != c.code || w.Body.String() != c.body || !reflect.DeepEqual(trace, c.trace) {
+			t.Errorf("%s %s = %d %q %q, want %d %q %q", c.method, c.path, w.Code, w.Body.String(), trace, c.code, c.body, c.trace)
+		}
+	}
+}
+
+func TestRouterErrorHandler(t *testing.T) {
+	var handled []string
+	handler := func(name string) func(*Context, error) {
+		return func(ctx *Context, err error) {
+			handled = append(handled, name+" "+strconv.Itoa(ErrorCode(err)))
+			DefaultErrorHandler(ctx, err)
+		}
+	}
+	s := New().ErrorHandler(handler("root"))
+	s.Get("/fail", func(*Context) error {
+		return Status(http.StatusConflict, "")
+	})
+	api := s.Route("/api").ErrorHandler(handler("api"))
+	v1 := api.Route("/v1")
+	v1.Get("/panic", func(*Context) error {
+		panic("boom")
+	})
+	v1.Get("/written", func(ctx *Context) error {
+		ctx.Text("partial")
+		return Status(http.StatusBadRequest, "late")
+	})
+	s.Get("/apix", func(*Context) error {
+		return Status(http.StatusTeapot, "")
+	})
+
+	cases := []struct {
+		path    string
+		code    int
+		body    string
+		handled string
+	}{
+		{"/fail", http.StatusConflict, "Conflict\n", "root 409"},
+		{"/api/v1/panic", http.StatusInternalServerError, "Internal Server Error\n", "api 500"},
+		{"/api/v1/written", http.StatusOK, "partial", "api 400"},
+		{"/api/v1/missing", http.StatusNotFound, "Not Found\n", "api 404"},
+		{"/apix", http.StatusTeapot, "I'm a teapot\n", "root 418"},
+	}
+	for _, c := range cases {
+		handled = nil
+		w := serve(s, http.MethodGet, c.path, nil)
+		if w.Code != c.code || w.Body.String() != c.body || len(handled) != 1 || handled[0] != c.handled {
+			t.Errorf("GET %s = %d %q handled by %q, want %d %q by %q", c.path, w.Code, w.Body.String(), handled, c.code, c.body, c.handled)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"time"
 )
 
@@ -19,14 +20,23 @@ type Server struct {
 // New creates a new server.
 func New() *Server {
 	router := &Router{
-		children: make(map[string]*Router),
-		handlers: make(map[string][]func(*Context) error),
+		node:  newNode(nil),
+		named: make(map[string]*route),
+
+		shutdown: make(chan struct{}),
+	}
+	server := &http.Server{
+		Handler: router,
 	}
+	var once sync.Once
+	server.RegisterOnShutdown(func() {
+		once.Do(func() {
+			close(router.shutdown)
+		})
+	})
 	return &Server{
 		Router: router,
-		server: &http.Server{
-			Handler: router,
-		},
+		server: server,
 	}
 }
 
@@ -103,7 +113,7 @@ func (a *Server) start() {
 	a.closed = make(chan struct{})
 	defer close(a.closed)
 
-	sigint := make(chan os.Signal)
+	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, os.Interrupt)
 	<-sigint
 
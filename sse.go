@@ -0,0 +1,162 @@
+package ws
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is the server-sent event.
+type Event struct {
+	// ID sets the last event ID of the client, which is sent back by Last-Event-ID on reconnect.
+	ID string
+	// Event is the event type, the client dispatches the "message" event if it is empty.
+	Event string
+	// Data is written as it is if it is a string or []byte, otherwise it is encoded as JSON.
+	// The event with the ID or the type but no data is sent with empty data, so the client still dispatches it.
+	Data interface{}
+	// Retry sets the reconnection time of the client if it is positive.
+	Retry time.Duration
+}
+
+// EventStream is the server-sent events stream, it is not safe for concurrent use.
+type EventStream struct {
+	ctx       *Context
+	w         *bufio.Writer
+	flusher   http.Flusher
+	heartbeat time.Duration
+}
+
+// EventStream starts the server-sent events stream.
+// It returns a 500 StatusError if the response writer does not support flushing.
+func (a *Context) EventStream() (*EventStream, error) {
+	f, ok := a.ResponseWriter.(http.Flusher)
+	if !ok {
+		return nil, Status(http.StatusInternalServerError, "ws: response writer does not support flushing")
+	}
+
+	header := a.ResponseWriter.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	a.ResponseWriter.WriteHeader(http.StatusOK)
+	f.Flush()
+	return &EventStream{
+		ctx:       a,
+		w:         bufio.NewWriter(a.ResponseWriter),
+		flusher:   f,
+		heartbeat: 15 * time.Second,
+	}, nil
+}
+
+// Heartbeat sets the interval of the heartbeat comments sent by Serve, the default is 15 seconds.
+// The heartbeat is disabled if d is not positive.
+func (a *EventStream) Heartbeat(d time.Duration) *EventStream {
+	a.heartbeat = d
+	return a
+}
+
+// LastEventID returns the ID of the last event received by the client before reconnecting.
+func (a *EventStream) LastEventID() string {
+	return a.ctx.Request.Header.Get("Last-Event-ID")
+}
+
+// Send sends the event and flushes it.
+func (a *EventStream) Send(e Event) error {
+	if strings.ContainsAny(e.ID, "\r\n\x00") || strings.ContainsAny(e.Event, "\r\n") {
+		return errors.New("ws: invalid event id or type")
+	}
+
+	if e.ID != "" {
+		a.w.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Event != "" {
+		a.w.WriteString("event: " + e.Event + "\n")
+	}
+	if e.Retry > 0 {
+		a.w.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	if e.Data != nil {
+		var data string
+		switch x := e.Data.(type) {
+		case string:
+			data = x
+		case []byte:
+			data = string(x)
+		default:
+			b, err := json.Marshal(x)
+			if err != nil {
+				return err
+			}
+			data = string(b)
+		}
+		data = strings.Replace(data, "\r\n", "\n", -1)
+		data = strings.Replace(data, "\r", "\n", -1)
+		for _, line := range strings.Split(data, "\n") {
+			a.w.WriteString("data: " + line + "\n")
+		}
+	} else if e.ID != "" || e.Event != "" {
+		a.w.WriteString("data:\n")
+	}
+	a.w.WriteByte('\n')
+	return a.flush()
+}
+
+// Comment sends the comment which is ignored by the client, it keeps the connection alive.
+func (a *EventStream) Comment(text string) error {
+	for _, line := range strings.Split(text, "\n") {
+		a.w.WriteString(": " + strings.TrimRight(line, "\r") + "\n")
+	}
+	a.w.WriteByte('\n')
+	return a.flush()
+}
+
+func (a *EventStream) flush() error {
+	if err := a.w.Flush(); err != nil {
+		return err
+	}
+	a.flusher.Flush()
+	return nil
+}
+
+// Serve sends the events from the channel and the heartbeats until the channel is closed.
+// It returns nil if the client goes away or the server shuts down.
+func (a *EventStream) Serve(events <-chan Event) error {
+	var tick <-chan time.Time
+	if a.heartbeat > 0 {
+		ticker := time.NewTicker(a.heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	done := a.ctx.Request.Context().Done()
+	shutdown := a.ctx.ShutdownNotify()
+	for {
+		var err error
+		select {
+		case <-done:
+			return nil
+		case <-shutdown:
+			return nil
+		case <-tick:
+			err = a.Comment("")
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			err = a.Send(e)
+		}
+		if err != nil {
+			select {
+			case <-done:
+				return nil
+			default:
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package ws
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestEventStream(t *testing.T) {
+	s := New()
+	s.Get("/events", func(ctx *Context) error {
+		es, err := ctx.EventStream()
+		if err != nil {
+			return err
+		}
+		if id := es.LastEventID(); id != "3" {
+			t.Errorf("LastEventID = %q", id)
+		}
+		es.Heartbeat(0)
+		events := make(chan Event, 8)
+		events <- Event{ID: "4", Event: "update", Data: map[string]int{"n": 1}}
+		events <- Event{Data: "line1\r\nline2"}
+		events <- Event{Event: "ping"}
+		events <- Event{Retry: 2 * time.Second}
+		close(events)
+		if err := es.Comment("hello"); err != nil {
+			return err
+		}
+		if err := es.Send(Event{ID: "bad\nid"}); err == nil {
+			t.Error("Send accepted the id with a newline")
+		}
+		return es.Serve(events)
+	})
+
+	w := serve(s, http.MethodGet, "/events", nil, "Last-Event-ID", "3")
+	if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("GET /events = %d %q", w.Code, ct)
+	}
+	want := ": hello\n\n" +
+		"id: 4\nevent: update\ndata: {\"n\":1}\n\n" +
+		"data: line1\ndata: line2\n\n" +
+		"event: ping\ndata:\n\n" +
+		"retry: 2000\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
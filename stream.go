@@ -0,0 +1,122 @@
+package ws
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// flushInterval is the max interval of flushing the streamed values to the client.
+const flushInterval = 100 * time.Millisecond
+
+// StreamJSON responses the values from the source as a JSON array without holding them in memory.
+// The source is a func() (interface{}, error) which returns io.EOF after the last value,
+// or a channel of any element type which is closed after the last value.
+// The response is flushed periodically and before waiting for the channel.
+// It stops and returns nil if the request is canceled, such as the client goes away.
+func (a *Context) StreamJSON(source interface{}) error {
+	return a.stream(source, "application/json; charset=utf-8", "[", ",", "", "]")
+}
+
+// StreamNDJSON responses the values from the source as newline delimited JSON like StreamJSON.
+func (a *Context) StreamNDJSON(source interface{}) error {
+	return a.stream(source, "application/x-ndjson", "", "", "\n", "")
+}
+
+func (a *Context) stream(source interface{}, contentType, open, sep, end, close string) error {
+	next := a.iterator(source)
+	a.ResponseWriter.Header().Set("Content-Type", contentType)
+	a.ResponseWriter.WriteHeader(a.statusCode())
+
+	done := a.Request.Context().Done()
+	w := bufio.NewWriter(a.ResponseWriter)
+	flushed := time.Now()
+	flush := func() error {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if f, ok := a.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+		flushed = time.Now()
+		return nil
+	}
+	canceled := func(err error) error {
+		select {
+		case <-done:
+			return nil
+		default:
+			return err
+		}
+	}
+
+	w.WriteString(open)
+	for i := 0; ; i++ {
+		select {
+		case <-done:
+			return nil
+		default:
+		}
+		value, err := next(flush)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return canceled(err)
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return canceled(err)
+		}
+		if i > 0 {
+			w.WriteString(sep)
+		}
+		w.Write(b)
+		w.WriteString(end)
+		if time.Since(flushed) >= flushInterval {
+			if err := flush(); err != nil {
+				return canceled(err)
+			}
+		}
+	}
+	w.WriteString(close)
+	return canceled(flush())
+}
+
+// iterator returns the iterator of the source, which calls flush before blocking if it can.
+func (a *Context) iterator(source interface{}) func(flush func() error) (interface{}, error) {
+	if next, ok := source.(func() (interface{}, error)); ok {
+		return func(func() error) (interface{}, error) {
+			return next()
+		}
+	}
+
+	ch := reflect.ValueOf(source)
+	if ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.RecvDir == 0 {
+		panic("ws: stream source must be a func() (interface{}, error) or a receivable channel")
+	}
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(a.Request.Context().Done())},
+		{Dir: reflect.SelectDefault},
+	}
+	return func(flush func() error) (interface{}, error) {
+		i, value, ok := reflect.Select(cases)
+		if i == 2 {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			i, value, ok = reflect.Select(cases[:2])
+		}
+		if i == 1 {
+			return nil, a.Request.Context().Err()
+		}
+		if !ok {
+			return nil, io.EOF
+		}
+		return value.Interface(), nil
+	}
+}
@@ -0,0 +1,99 @@
+package ws
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	s := New()
+	s.Get("/chan", func(ctx *Context) error {
+		ch := make(chan int, 3)
+		ch <- 1
+		ch <- 2
+		ch <- 3
+		close(ch)
+		return ctx.StreamJSON(ch)
+	})
+	s.Post("/func", func(ctx *Context) error {
+		values := []interface{}{map[string]int{"a": 1}, "b", nil}
+		return ctx.StreamJSON(func() (interface{}, error) {
+			if len(values) == 0 {
+				return nil, io.EOF
+			}
+			v := values[0]
+			values = values[1:]
+			return v, nil
+		})
+	})
+	s.Get("/empty", func(ctx *Context) error {
+		ch := make(chan int)
+		close(ch)
+		return ctx.StreamJSON(ch)
+	})
+	s.Get("/ndjson", func(ctx *Context) error {
+		ch := make(chan string, 2)
+		ch <- "a"
+		ch <- "b"
+		close(ch)
+		return ctx.StreamNDJSON(ch)
+	})
+
+	cases := []struct {
+		method string
+		path   string
+		code   int
+		ct     string
+		body   string
+	}{
+		{http.MethodGet, "/chan", http.StatusOK, "application/json; charset=utf-8", "[1,2,3]"},
+		{http.MethodPost, "/func", http.StatusCreated, "application/json; charset=utf-8", `[{"a":1},"b",null]`},
+		{http.MethodGet, "/empty", http.StatusOK, "application/json; charset=utf-8", "[]"},
+		{http.MethodGet, "/ndjson", http.StatusOK, "application/x-ndjson", "\"a\"\n\"b\"\n"},
+	}
+	for _, c := range cases {
+		w := serve(s, c.method, c.path, nil)
+		if w.Code != c.code || w.Header().Get("Content-Type") != c.ct || w.Body.String() != c.body || !w.Flushed {
+			t.Errorf("%s %s = %d %q %q, want %d %q %q", c.method, c.path, w.Code, w.Header().Get("Content-Type"), w.Body.String(), c.code, c.ct, c.body)
+		}
+	}
+}
+
+func TestStreamCanceled(t *testing.T) {
+	ch := make(chan int)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ch <- 1
+		cancel()
+	}()
+
+	var err error
+	s := New()
+	s.Get("/", func(ctx *Context) error {
+		err = ctx.StreamJSON(ch)
+		return err
+	})
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	// the rest is not flushed since the client is gone.
+	if body := w.Body.String(); err != nil || !strings.HasPrefix(body, "[") || strings.HasSuffix(body, "]") {
+		t.Errorf("StreamJSON = %v %q, want nil and the partial body", err, body)
+	}
+}
+
+func TestStreamSource(t *testing.T) {
+	for _, source := range []interface{}{42, make(chan<- int), func() interface{} { return nil }} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("StreamJSON(%T) does not panic", source)
+				}
+			}()
+			(&Context{}).StreamJSON(source)
+		}()
+	}
+}
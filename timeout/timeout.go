@@ -0,0 +1,182 @@
+package timeout
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ofunc/ws"
+)
+
+// New creates a timeout middleware, which runs the rest handlers in a goroutine on a fork of the context,
+// whose request context is canceled after d. The middleware returns at d without waiting for them,
+// with a StatusError of the code, such as http.StatusServiceUnavailable or http.StatusGatewayTimeout.
+// The responses are buffered until the handlers return, and they are discarded at d,
+// then the later writes fail with http.ErrHandlerTimeout. Flushing commits the buffered response,
+// and the later writes are not buffered.
+// The rest handlers see the buffered response by Written and Response of their context,
+// they can push if the response writer supports it, but they can not hijack the connection.
+func New(d time.Duration, code int) func(*ws.Context) error {
+	text := "timeout: handler exceeded " + d.String()
+	return func(ctx *ws.Context) error {
+		if d <= 0 {
+			return ctx.Next()
+		}
+
+		c, cancel := context.WithTimeout(ctx.Request.Context(), d)
+		defer cancel()
+		tw := &writer{
+			w:      ctx.ResponseWriter,
+			header: ctx.ResponseWriter.Header().Clone(),
+		}
+		var w http.ResponseWriter = tw
+		if _, ok := ctx.ResponseWriter.(http.Pusher); ok {
+			w = pushWriter{tw}
+		}
+		fork := ctx.Fork(w)
+		fork.Request = fork.Request.WithContext(c)
+
+		var err error
+		var panicked interface{}
+		done := make(chan struct{})
+		go func() {
+			defer func() {
+				panicked = recover()
+				close(done)
+			}()
+			err = fork.Next()
+			if err == nil {
+				// write the implicit header by the wrapper to call the before-write hooks of the fork.
+				fork.Response().WriteHeader(http.StatusOK)
+			}
+		}()
+
+		select {
+		case <-done:
+		case <-c.Done():
+			select {
+			case <-done:
+			default:
+				tw.timeout()
+				if c.Err() == context.DeadlineExceeded {
+					return ws.Status(code, text).Wrap(c.Err())
+				}
+				return c.Err()
+			}
+		}
+		if panicked != nil {
+			panic(panicked)
+		}
+		tw.mu.Lock()
+		tw.commit()
+		tw.mu.Unlock()
+		return err
+	}
+}
+
+// writer buffers the response until it is committed, it is safe for concurrent use.
+type writer struct {
+	mu        sync.Mutex
+	w         http.ResponseWriter
+	header    http.Header
+	code      int
+	buf       bytes.Buffer
+	committed bool
+	timedOut  bool
+}
+
+// Header returns the buffered header, which is copied to the wrapped writer when committing.
+func (a *writer) Header() http.Header {
+	return a.header
+}
+
+func (a *writer) WriteHeader(code int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.timedOut {
+		return
+	}
+	if a.committed {
+		a.w.WriteHeader(code)
+	} else if a.code == 0 {
+		a.code = code
+	}
+}
+
+func (a *writer) Write(b []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if a.committed {
+		return a.w.Write(b)
+	}
+	if a.code == 0 {
+		a.code = http.StatusOK
+	}
+	return a.buf.Write(b)
+}
+
+// Flush commits the buffered response and flushes it.
+func (a *writer) Flush() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.timedOut {
+		return
+	}
+	if a.code == 0 {
+		a.code = http.StatusOK
+	}
+	a.commit()
+	if f, ok := a.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// timeout discards the buffered response, and makes the later writes fail.
+func (a *writer) timeout() {
+	a.mu.Lock()
+	a.timedOut = true
+	a.buf = bytes.Buffer{}
+	a.mu.Unlock()
+}
+
+// commit copies the buffered header and body to the wrapped writer, the writer must be locked.
+// The header is copied even if nothing is written, so the error handler can use it.
+func (a *writer) commit() {
+	if a.committed {
+		return
+	}
+	a.committed = true
+	header := a.w.Header()
+	for k := range header {
+		if _, ok := a.header[k]; !ok {
+			delete(header, k)
+		}
+	}
+	for k, vs := range a.header {
+		header[k] = vs
+	}
+	if a.code == 0 {
+		return
+	}
+	a.w.WriteHeader(a.code)
+	a.buf.WriteTo(a.w)
+}
+
+// pushWriter is the writer which forwards the pushes to the wrapped writer.
+type pushWriter struct {
+	*writer
+}
+
+func (a pushWriter) Push(target string, opts *http.PushOptions) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.timedOut {
+		return http.ErrHandlerTimeout
+	}
+	return a.w.(http.Pusher).Push(target, opts)
+}
@@ -0,0 +1,101 @@
+package timeout
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ofunc/ws"
+)
+
+func TestTimeout(t *testing.T) {
+	late := make(chan error, 1)
+	s := ws.New()
+	s.Use(func(ctx *ws.Context) error {
+		ctx.ResponseWriter.Header().Set("X-Outer", "1")
+		return ctx.Next()
+	})
+	s.Use(New(50*time.Millisecond, http.StatusServiceUnavailable))
+	s.Get("/fast", func(ctx *ws.Context) error {
+		ctx.ResponseWriter.Header().Set("X-Inner", "1")
+		ctx.Status(http.StatusAccepted)
+		if err := ctx.Text("ok"); err != nil {
+			return err
+		}
+		if !ctx.Written() || ctx.Response().Status() != http.StatusAccepted {
+			t.Errorf("Written = %v, Status = %d in the fork", ctx.Written(), ctx.Response().Status())
+		}
+		return nil
+	})
+	s.Get("/slow", func(ctx *ws.Context) error {
+		ctx.ResponseWriter.Write([]byte("early"))
+		time.Sleep(500 * time.Millisecond)
+		_, err := ctx.ResponseWriter.Write([]byte("late"))
+		late <- err
+		return nil
+	})
+	s.Get("/error", func(ctx *ws.Context) error {
+		ctx.ResponseWriter.Header().Set("X-Inner", "1")
+		return ws.Status(http.StatusBadRequest, "bad")
+	})
+	s.Get("/hijack", func(ctx *ws.Context) error {
+		_, _, err := ctx.Hijack()
+		return err
+	})
+	s.Get("/panic", func(ctx *ws.Context) error {
+		panic("boom")
+	})
+
+	cases := []struct {
+		path   string
+		code   int
+		header string
+		body   string
+	}{
+		{"/fast", http.StatusAccepted, "X-Inner", "ok"},
+		{"/slow", http.StatusServiceUnavailable, "X-Outer", http.StatusText(http.StatusServiceUnavailable) + "\n"},
+		{"/error", http.StatusBadRequest, "X-Inner", ""},
+		{"/hijack", http.StatusInternalServerError, "X-Outer", ""},
+		{"/panic", http.StatusInternalServerError, "X-Outer", ""},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		start := time.Now()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+			t.Errorf("GET %s took %v", c.path, elapsed)
+		}
+		if w.Code != c.code || w.Header().Get(c.header) != "1" || c.body != "" && w.Body.String() != c.body {
+			t.Errorf("GET %s = %d %v %q, want %d with %s %q", c.path, w.Code, w.Header(), w.Body.String(), c.code, c.header, c.body)
+		}
+	}
+	if err := <-late; err != http.ErrHandlerTimeout {
+		t.Errorf("late write = %v, want ErrHandlerTimeout", err)
+	}
+}
+
+func TestTimeoutFlush(t *testing.T) {
+	late := make(chan error, 1)
+	s := ws.New()
+	s.Use(New(50*time.Millisecond, http.StatusGatewayTimeout))
+	s.Get("/", func(ctx *ws.Context) error {
+		ctx.ResponseWriter.Write([]byte("a"))
+		ctx.ResponseWriter.(http.Flusher).Flush()
+		ctx.ResponseWriter.Write([]byte("b"))
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		_, err := ctx.ResponseWriter.Write([]byte("c"))
+		late <- err
+		return ctx.Err()
+	})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || !w.Flushed || w.Body.String() != "ab" {
+		t.Errorf("GET / = %d %q flushed %v, want 200 ab", w.Code, w.Body.String(), w.Flushed)
+	}
+	if err := <-late; err != http.ErrHandlerTimeout {
+		t.Errorf("late write = %v, want ErrHandlerTimeout", err)
+	}
+}
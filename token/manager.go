@@ -77,7 +77,7 @@ func (a *Manager) Checker(renew bool) func(*ws.Context) error {
 			value := a.value()
 			if age, err := t.decode(cookie.Value, value, renew); err == nil {
 				if renew {
-					http.SetCookie(ctx.ResponseWriter, &http.Cookie{
+					cookie := &http.Cookie{
 						Name:     a.name,
 						Value:    t.String(),
 						MaxAge:   age,
@@ -85,6 +85,11 @@ func (a *Manager) Checker(renew bool) func(*ws.Context) error {
 						Secure:   a.secure,
 						HttpOnly: true,
 						SameSite: http.SameSiteStrictMode,
+					}
+					ctx.BeforeWrite(func(ctx *ws.Context) {
+						if ctx.Response().Status() < http.StatusBadRequest {
+							http.SetCookie(ctx.ResponseWriter, cookie)
+						}
 					})
 				}
 				ctx.Set(a.name, value)
@@ -0,0 +1,76 @@
+package token
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ofunc/ws"
+)
+
+type user struct {
+	Name string `json:"name"`
+}
+
+func TestChecker(t *testing.T) {
+	m := New("token", "/", false, []byte("key"), func() interface{} { return new(user) })
+	s := ws.New()
+	s.Post("/login", func(ctx *ws.Context) error {
+		return m.Create(ctx, 3600, user{"a"})
+	})
+	private := s.Route("/private").Use(m.Checker(true))
+	private.Get("/ok", func(ctx *ws.Context) error {
+		if u, ok := ctx.Get("token").(*user); !ok || u.Name != "a" {
+			t.Errorf("token value = %v", ctx.Get("token"))
+		}
+		return ctx.Text("ok")
+	})
+	private.Get("/fail", func(ctx *ws.Context) error {
+		return ws.Status(http.StatusForbidden, "no")
+	})
+	private.Get("/panic", func(ctx *ws.Context) error {
+		panic("boom")
+	})
+
+	serve := func(method, target string, cookie *http.Cookie) *http.Response {
+		r := httptest.NewRequest(method, target, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Result()
+	}
+	resp := serve(http.MethodPost, "/login", nil)
+	if len(resp.Cookies()) != 1 {
+		t.Fatalf("POST /login cookies = %v", resp.Cookies())
+	}
+	cookie := resp.Cookies()[0]
+
+	cases := []struct {
+		path   string
+		cookie *http.Cookie
+		code   int
+		maxAge int
+	}{
+		{"/private/ok", cookie, http.StatusOK, 3600},
+		{"/private/fail", cookie, http.StatusForbidden, 0},
+		{"/private/panic", cookie, http.StatusInternalServerError, 0},
+		{"/private/missing", cookie, http.StatusNotFound, 0},
+		{"/private/ok", nil, http.StatusUnauthorized, -1},
+		{"/private/ok", &http.Cookie{Name: "token", Value: cookie.Value + "x"}, http.StatusUnauthorized, -1},
+	}
+	for _, c := range cases {
+		resp := serve(http.MethodGet, c.path, c.cookie)
+		cookies := resp.Cookies()
+		if resp.StatusCode != c.code {
+			t.Errorf("GET %s = %d, want %d", c.path, resp.StatusCode, c.code)
+		}
+		switch {
+		case c.maxAge == 0 && len(cookies) != 0:
+			t.Errorf("GET %s renewed the token on %d: %v", c.path, resp.StatusCode, cookies)
+		case c.maxAge != 0 && (len(cookies) != 1 || cookies[0].MaxAge != c.maxAge):
+			t.Errorf("GET %s cookies = %v, want MaxAge %d", c.path, cookies, c.maxAge)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Validator validates the value by the param of the rule, such as 100 of max=100.
+// It returns the reason if the value is invalid.
+type Validator func(v reflect.Value, param string) error
+
+var validators = map[string]Validator{
+	"required": validateRequired,
+	"min":      validateMin,
+	"max":      validateMax,
+	"len":      validateLen,
+	"email":    validateEmail,
+	"oneof":    validateOneOf,
+}
+
+// RegisterValidator registers the validator for the rule name, it is not safe to call concurrently with Validate.
+func RegisterValidator(name string, v Validator) {
+	validators[name] = v
+	resetRules()
+}
+
+// FieldError is the validation error of a field.
+type FieldError struct {
+	Field  string `json:"field" xml:"field"`
+	Reason string `json:"reason" xml:"reason"`
+}
+
+// Validate validates the struct by the validate tags, such as `validate:"required,min=1,max=100"`.
+// The rule omitempty skips the other rules if the value is zero,
+// and the rules except required are skipped if the value is a nil pointer.
+// It returns a 422 Problem with the extension errors which lists the failed fields.
+func Validate(v interface{}) error {
+	var errs []FieldError
+	if err := validateValue(reflect.ValueOf(v), "", &errs); err != nil {
+		return err
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	reasons := make([]string, len(errs))
+	for i, e := range errs {
+		reasons[i] = e.Field + ": " + e.Reason
+	}
+	return NewProblem(http.StatusUnprocessableEntity, strings.Join(reasons, "; ")).With("errors", errs)
+}
+
+// CheckRules checks the validate tags of the type of v and the nested types,
+// such as unknown rule names and invalid params, so the mistakes can be found at startup.
+func CheckRules(v interface{}) error {
+	return checkType(reflect.TypeOf(v), make(map[reflect.Type]bool))
+}
+
+func checkType(t reflect.Type, seen map[reflect.Type]bool) error {
+	for t != nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array:
+			t = t.Elem()
+			continue
+		case reflect.Struct:
+			if seen[t] {
+				return nil
+			}
+			seen[t] = true
+			fs, err := rulesOf(t)
+			if err != nil {
+				return err
+			}
+			for _, f := range fs {
+				if err := checkType(t.Field(f.index).Type, seen); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+type rule struct {
+	name  string
+	param string
+	fn    Validator
+}
+
+type fieldRules struct {
+	index int
+	name  string
+	rules []rule
+}
+
+type structRules struct {
+	fields []fieldRules
+	err    error
+}
+
+// typeRules caches the parsed rules of the struct types.
+var typeRules sync.Map
+
+// resetRules clears the cached rules, which are parsed by the validators at that time.
+func resetRules() {
+	typeRules.Range(func(k, _ interface{}) bool {
+		typeRules.Delete(k)
+		return true
+	})
+}
+
+// rulesOf returns the parsed rules of the fields of the struct type.
+func rulesOf(t reflect.Type) ([]fieldRules, error) {
+	if x, ok := typeRules.Load(t); ok {
+		sr := x.(*structRules)
+		return sr.fields, sr.err
+	}
+
+	sr := new(structRules)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		fr := fieldRules{index: i}
+		if !f.Anonymous {
+			fr.name = fieldName(f)
+		}
+		rules, err := parseRules(f.Tag.Get("validate"))
+		if err != nil {
+			sr.err = errors.New("ws: validate tag of " + t.String() + "." + f.Name + ": " + err.Error())
+			break
+		}
+		fr.rules = rules
+		sr.fields = append(sr.fields, fr)
+	}
+	typeRules.Store(t, sr)
+	return sr.fields, sr.err
+}
+
+// parseRules parses the rules of the validate tag.
+func parseRules(tag string) ([]rule, error) {
+	if tag == "" || tag == "-" {
+		return nil, nil
+	}
+	var rules []rule
+	for _, s := range strings.Split(tag, ",") {
+		r := rule{name: s}
+		if i := strings.IndexByte(s, '='); i >= 0 {
+			r.name, r.param = s[:i], s[i+1:]
+		}
+		switch r.name {
+		case "omitempty":
+			rules = append(rules, r)
+			continue
+		case "min", "max", "len":
+			if _, err := strconv.ParseFloat(r.param, 64); err != nil {
+				return nil, errors.New("invalid param of rule " + strconv.Quote(s))
+			}
+		}
+		fn, ok := validators[r.name]
+		if !ok {
+			return nil, errors.New("unknown rule " + strconv.Quote(r.name))
+		}
+		r.fn = fn
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// validateValue validates the struct fields in v, path is the field path of v.
+func validateValue(v reflect.Value, path string, errs *[]FieldError) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateValue(v.Index(i), path+"["+strconv.Itoa(i)+"]", errs); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fs, err := rulesOf(v.Type())
+		if err != nil {
+			return err
+		}
+		for _, f := range fs {
+			fpath := path
+			if f.name != "" {
+				fpath = joinPath(path, f.name)
+			}
+			fv := v.Field(f.index)
+			validateField(fv, f.rules, fpath, errs)
+			if err := validateValue(fv, fpath, errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateField validates the field by the rules, and stops at the first failed rule.
+func validateField(v reflect.Value, rules []rule, path string, errs *[]FieldError) {
+	null := (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil()
+	for _, r := range rules {
+		if r.name == "omitempty" {
+			if isEmpty(v) {
+				return
+			}
+			continue
+		}
+		if null && r.name != "required" {
+			continue
+		}
+		if err := r.fn(v, r.param); err != nil {
+			*errs = append(*errs, FieldError{
+				Field:  path,
+				Reason: err.Error(),
+			})
+			return
+		}
+	}
+}
+
+// fieldName returns the JSON name of the field if it has.
+func fieldName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return f.Name
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+func validateRequired(v reflect.Value, param string) error {
+	if isEmpty(v) {
+		return errors.New("is required")
+	}
+	return nil
+}
+
+func validateMin(v reflect.Value, param string) error {
+	n, p, err := measure(v, param)
+	if err != nil {
+		return err
+	}
+	if n < p {
+		return errors.New("must be at least " + param)
+	}
+	return nil
+}
+
+func validateMax(v reflect.Value, param string) error {
+	n, p, err := measure(v, param)
+	if err != nil {
+		return err
+	}
+	if n > p {
+		return errors.New("must be at most " + param)
+	}
+	return nil
+}
+
+func validateLen(v reflect.Value, param string) error {
+	n, p, err := measure(v, param)
+	if err != nil {
+		return err
+	}
+	if n != p {
+		return errors.New("must have length " + param)
+	}
+	return nil
+}
+
+func validateEmail(v reflect.Value, param string) error {
+	v = reflect.Indirect(v)
+	if v.Kind() != reflect.String {
+		return errors.New("is not a string")
+	}
+	if addr, err := mail.ParseAddress(v.String()); err != nil || addr.Address != v.String() {
+		return errors.New("must be an email address")
+	}
+	return nil
+}
+
+func validateOneOf(v reflect.Value, param string) error {
+	v = reflect.Indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+	s := fmt.Sprint(v.Interface())
+	for _, p := range strings.Fields(param) {
+		if p == s {
+			return nil
+		}
+	}
+	return errors.New("must be one of " + param)
+}
+
+// measure returns the number or the length of v, and the param as number.
+func measure(v reflect.Value, param string) (float64, float64, error) {
+	p, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return 0, 0, errors.New("has invalid rule param " + strconv.Quote(param))
+	}
+
+	v = reflect.Indirect(v)
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), p, nil
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), p, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), p, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), p, nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), p, nil
+	default:
+		return 0, 0, errors.New("is not measurable")
+	}
+}
@@ -0,0 +1,123 @@
+package ws
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type validateAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type validateUser struct {
+	Name    string            `json:"name" validate:"required,min=2,max=5"`
+	Email   string            `json:"email" validate:"omitempty,email"`
+	Role    string            `json:"role" validate:"oneof=admin user"`
+	Age     *int              `json:"age" validate:"min=18"`
+	Nick    *string           `json:"nick" validate:"required"`
+	Tags    []string          `json:"tags" validate:"max=2"`
+	Address validateAddress   `json:"address"`
+	Others  []validateAddress `json:"others"`
+}
+
+func validateErrors(t *testing.T, err error) []FieldError {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var p *Problem
+	if !errors.As(err, &p) || p.Status != http.StatusUnprocessableEntity {
+		t.Fatalf("err = %v, want 422 Problem", err)
+	}
+	return p.Extensions["errors"].([]FieldError)
+}
+
+func TestValidate(t *testing.T) {
+	nick, age := "x", 20
+	ok := validateUser{Name: "abc", Role: "user", Nick: &nick, Age: &age, Address: validateAddress{"c"}}
+	if err := Validate(&ok); err != nil {
+		t.Fatalf("Validate(valid) = %v", err)
+	}
+
+	young := 3
+	bad := validateUser{
+		Name:   "a",
+		Email:  "nope",
+		Role:   "root",
+		Age:    &young,
+		Tags:   []string{"a", "b", "c"},
+		Others: []validateAddress{{"c"}, {}},
+	}
+	got := validateErrors(t, Validate(&bad))
+	want := []FieldError{
+		{"name", "must be at least 2"},
+		{"email", "must be an email address"},
+		{"role", "must be one of admin user"},
+		{"age", "must be at least 18"},
+		{"nick", "is required"},
+		{"tags", "must be at most 2"},
+		{"address.city", "is required"},
+		{"others[1].city", "is required"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("errors = %v, want %v", got, want)
+	}
+}
+
+func TestValidateNilPointer(t *testing.T) {
+	nick := "x"
+	v := validateUser{Name: "abc", Role: "admin", Nick: &nick, Address: validateAddress{"c"}}
+	if err := Validate(&v); err != nil {
+		t.Errorf("Validate with nil age = %v", err)
+	}
+}
+
+func TestValidateInvalidTags(t *testing.T) {
+	type typo struct {
+		Name string `validate:"requird"`
+	}
+	type param struct {
+		Name string `validate:"min=x"`
+	}
+	type nested struct {
+		Items []*typo
+	}
+	for _, v := range []interface{}{typo{}, param{}, &nested{}} {
+		err := CheckRules(v)
+		if err == nil || !strings.HasPrefix(err.Error(), "ws: validate tag of ") {
+			t.Errorf("CheckRules(%T) = %v", v, err)
+		}
+	}
+	if err := Validate(&typo{Name: "x"}); err == nil || ErrorCode(err) != http.StatusInternalServerError {
+		t.Errorf("Validate(typo) = %v", err)
+	}
+	if err := CheckRules(&validateUser{}); err != nil {
+		t.Errorf("CheckRules(validateUser) = %v", err)
+	}
+}
+
+func TestRegisterValidator(t *testing.T) {
+	type even struct {
+		N int `json:"n" validate:"even"`
+	}
+	if err := CheckRules(even{}); err == nil {
+		t.Fatal("unknown rule even accepted")
+	}
+	RegisterValidator("even", func(v reflect.Value, param string) error {
+		if v.Int()%2 != 0 {
+			return errors.New("must be even")
+		}
+		return nil
+	})
+	defer func() {
+		delete(validators, "even")
+		resetRules()
+	}()
+	got := validateErrors(t, Validate(&even{3}))
+	if len(got) != 1 || got[0] != (FieldError{"n", "must be even"}) {
+		t.Errorf("errors = %v", got)
+	}
+}
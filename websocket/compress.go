@@ -0,0 +1,157 @@
+package websocket
+
+import (
+	"compress/flate"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// flateTail terminates the compressed message, which is the removed sync flush marker
+// and an empty final stored block.
+const flateTail = "\x00\x00\xff\xff\x01\x00\x00\xff\xff"
+
+var (
+	flateWriters sync.Pool
+	flateReaders sync.Pool
+)
+
+func newFlateWriter(w io.Writer) *flate.Writer {
+	if fw, ok := flateWriters.Get().(*flate.Writer); ok {
+		fw.Reset(w)
+		return fw
+	}
+	fw, _ := flate.NewWriter(w, flate.BestSpeed)
+	return fw
+}
+
+func putFlateWriter(fw *flate.Writer) {
+	fw.Reset(nil)
+	flateWriters.Put(fw)
+}
+
+// flateReader decompresses a message, it is put back to the pool at the end of the message.
+type flateReader struct {
+	fr io.ReadCloser
+}
+
+func newFlateReader(r io.Reader) io.Reader {
+	r = io.MultiReader(r, strings.NewReader(flateTail))
+	if fr, ok := flateReaders.Get().(io.ReadCloser); ok {
+		fr.(flate.Resetter).Reset(r, nil)
+		return &flateReader{fr}
+	}
+	return &flateReader{flate.NewReader(r)}
+}
+
+func (a *flateReader) Read(p []byte) (int, error) {
+	if a.fr == nil {
+		return 0, io.EOF
+	}
+	n, err := a.fr.Read(p)
+	if err == io.EOF {
+		a.fr.Close()
+		flateReaders.Put(a.fr)
+		a.fr = nil
+	}
+	return n, err
+}
+
+// truncWriter holds back the last 4 bytes written, which is the sync flush marker at the end of the message.
+type truncWriter struct {
+	w    io.Writer
+	tail [4]byte
+	n    int
+}
+
+func (a *truncWriter) Write(p []byte) (int, error) {
+	m := len(p)
+	if a.n+len(p) <= len(a.tail) {
+		a.n += copy(a.tail[a.n:], p)
+		return m, nil
+	}
+
+	// write the held bytes and p except the last 4 bytes of them.
+	k := a.n + len(p) - len(a.tail)
+	if k <= a.n {
+		if _, err := a.w.Write(a.tail[:k]); err != nil {
+			return 0, err
+		}
+		a.n = copy(a.tail[:], a.tail[k:a.n])
+		a.n += copy(a.tail[a.n:], p)
+		return m, nil
+	}
+	if _, err := a.w.Write(a.tail[:a.n]); err != nil {
+		return 0, err
+	}
+	k -= a.n
+	if _, err := a.w.Write(p[:k]); err != nil {
+		return 0, err
+	}
+	a.n = copy(a.tail[:], p[k:])
+	return m, nil
+}
+
+// deflateOffer is the permessage-deflate offer of the client, the context takeover is not supported.
+const deflateOffer = "permessage-deflate; server_no_context_takeover; client_no_context_takeover"
+
+// acceptDeflate reports whether the client offers permessage-deflate which can be accepted.
+func acceptDeflate(header http.Header) bool {
+	for _, ext := range parseExtensions(header) {
+		if ext[0] != "permessage-deflate" {
+			continue
+		}
+		ok := true
+		for _, p := range ext[1:] {
+			switch {
+			case p == "server_no_context_takeover", p == "client_no_context_takeover":
+			case p == "client_max_window_bits", strings.HasPrefix(p, "client_max_window_bits="):
+			case p == "server_max_window_bits=15":
+			default:
+				ok = false
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// agreedDeflate reports whether the server agrees permessage-deflate without the server context takeover.
+func agreedDeflate(header http.Header) (bool, error) {
+	for _, ext := range parseExtensions(header) {
+		if ext[0] != "permessage-deflate" {
+			return false, errHandshake("unsupported extension " + ext[0])
+		}
+		for _, p := range ext[1:] {
+			if p == "server_no_context_takeover" {
+				return true, nil
+			}
+		}
+		return false, errHandshake("permessage-deflate without server_no_context_takeover")
+	}
+	return false, nil
+}
+
+// parseExtensions parses the Sec-WebSocket-Extensions headers into the names and params of the extensions.
+func parseExtensions(header http.Header) [][]string {
+	var exts [][]string
+	for _, h := range header["Sec-Websocket-Extensions"] {
+		for _, s := range strings.Split(h, ",") {
+			var ext []string
+			for _, p := range strings.Split(s, ";") {
+				p = strings.TrimSpace(p)
+				if i := strings.IndexByte(p, '='); i >= 0 {
+					p = strings.TrimSpace(p[:i]) + "=" + strings.Trim(strings.TrimSpace(p[i+1:]), `"`)
+				}
+				ext = append(ext, strings.ToLower(p))
+			}
+			if ext[0] != "" {
+				exts = append(exts, ext)
+			}
+		}
+	}
+	return exts
+}
@@ -0,0 +1,631 @@
+package websocket
+
+import (
+	"bufio"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// closeTimeout is the max time of waiting for the close frame of the peer.
+const closeTimeout = 5 * time.Second
+
+// writeBufferSize is the max payload size of the frames written by NextWriter.
+const writeBufferSize = 4096
+
+// Conn is the WebSocket connection.
+// It supports one concurrent reader and one concurrent writer,
+// and WriteControl, Ping and Close can be called concurrently with them.
+type Conn struct {
+	conn        net.Conn
+	server      bool
+	subprotocol string
+	compress    bool
+	readLimit   int64
+	onPong      func([]byte)
+
+	// the read state, readSem is held during reading.
+	readSem   chan struct{}
+	br        *bufio.Reader
+	readErr   error
+	inMessage bool
+	final     bool
+	remaining int64
+	masked    bool
+	key       [4]byte
+	pos       int
+	seq       int
+
+	// the write state, writeMu is held during writing a frame.
+	writeMu   sync.Mutex
+	bw        *bufio.Writer
+	writeErr  error
+	closeSent bool
+
+	closeOnce sync.Once
+	received  chan struct{}
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, bw *bufio.Writer, server bool) *Conn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	if bw == nil {
+		bw = bufio.NewWriter(conn)
+	}
+	return &Conn{
+		conn:      conn,
+		server:    server,
+		readLimit: DefaultReadLimit,
+		readSem:   make(chan struct{}, 1),
+		br:        br,
+		bw:        bw,
+		received:  make(chan struct{}),
+	}
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (a *Conn) Subprotocol() string {
+	return a.subprotocol
+}
+
+// Compressed reports whether the permessage-deflate extension is negotiated.
+func (a *Conn) Compressed() bool {
+	return a.compress
+}
+
+// NetConn returns the underlying connection.
+func (a *Conn) NetConn() net.Conn {
+	return a.conn
+}
+
+// LocalAddr returns the local network address.
+func (a *Conn) LocalAddr() net.Addr {
+	return a.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (a *Conn) RemoteAddr() net.Addr {
+	return a.conn.RemoteAddr()
+}
+
+// ReadLimit sets the max size of the read messages, it is unlimited if n is not positive.
+// The connection is closed with CloseMessageTooBig if a message exceeds it.
+func (a *Conn) ReadLimit(n int64) *Conn {
+	a.readLimit = n
+	return a
+}
+
+// OnPong sets the handler of the pong frames, it is called by the reading goroutine.
+func (a *Conn) OnPong(h func(data []byte)) *Conn {
+	a.onPong = h
+	return a
+}
+
+// SetReadDeadline sets the deadline of reading.
+func (a *Conn) SetReadDeadline(t time.Time) error {
+	return a.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline of writing.
+func (a *Conn) SetWriteDeadline(t time.Time) error {
+	return a.conn.SetWriteDeadline(t)
+}
+
+// ReadMessage reads the whole next data message.
+// The ping frames are answered automatically, and the close frame is returned as *CloseError.
+func (a *Conn) ReadMessage() (MessageType, []byte, error) {
+	typ, r, err := a.NextReader()
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if typ == TextMessage && !utf8.Valid(data) {
+		return 0, nil, a.fail(CloseInvalidFramePayloadData, errInvalidUTF8)
+	}
+	return typ, data, nil
+}
+
+// NextReader returns the reader of the next data message, the unread data of the previous message is discarded.
+// The reader is valid until the next call of NextReader or ReadMessage.
+func (a *Conn) NextReader() (MessageType, io.Reader, error) {
+	a.readSem <- struct{}{}
+	defer func() { <-a.readSem }()
+
+	if err := a.discard(); err != nil {
+		return 0, nil, err
+	}
+	op, rsv1, err := a.nextFrame(false)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	a.seq++
+	var r io.Reader = &frameReader{conn: a, seq: a.seq}
+	if rsv1 {
+		r = newFlateReader(r)
+	}
+	if a.readLimit > 0 {
+		r = &limitReader{conn: a, r: r, n: a.readLimit}
+	}
+	return MessageType(op), r, nil
+}
+
+// discard discards the remaining frames of the current message.
+func (a *Conn) discard() error {
+	for a.readErr == nil && a.inMessage {
+		if a.remaining > 0 {
+			n, err := io.CopyN(ioutil.Discard, a.br, a.remaining)
+			a.remaining -= n
+			if err != nil {
+				return a.readFailed(err)
+			}
+		}
+		if a.final {
+			a.inMessage = false
+			break
+		}
+		if _, _, err := a.nextFrame(true); err != nil {
+			return err
+		}
+	}
+	return a.readErr
+}
+
+// nextFrame reads the frame header of the next data frame, the control frames before it are handled.
+// It returns the opcode and whether the RSV1 bit is set.
+func (a *Conn) nextFrame(continuation bool) (byte, bool, error) {
+	for {
+		if a.readErr != nil {
+			return 0, false, a.readErr
+		}
+
+		var b [8]byte
+		if _, err := io.ReadFull(a.br, b[:2]); err != nil {
+			return 0, false, a.readFailed(err)
+		}
+		fin, rsv1, rsv23, op := b[0]&0x80 != 0, b[0]&0x40 != 0, b[0]&0x30 != 0, b[0]&0x0f
+		masked, n := b[1]&0x80 != 0, int64(b[1]&0x7f)
+		switch n {
+		case 126:
+			if _, err := io.ReadFull(a.br, b[:2]); err != nil {
+				return 0, false, a.readFailed(err)
+			}
+			n = int64(binary.BigEndian.Uint16(b[:2]))
+		case 127:
+			if _, err := io.ReadFull(a.br, b[:8]); err != nil {
+				return 0, false, a.readFailed(err)
+			}
+			u := binary.BigEndian.Uint64(b[:8])
+			if u>>63 != 0 {
+				return 0, false, a.fail(CloseProtocolError, errProtocol("invalid payload length"))
+			}
+			n = int64(u)
+		}
+		if masked != a.server {
+			return 0, false, a.fail(CloseProtocolError, errProtocol("invalid mask bit"))
+		}
+		if masked {
+			if _, err := io.ReadFull(a.br, a.key[:]); err != nil {
+				return 0, false, a.readFailed(err)
+			}
+		}
+		if rsv23 {
+			return 0, false, a.fail(CloseProtocolError, errProtocol("reserved bits set"))
+		}
+
+		switch op {
+		case opContinuation, opText, opBinary:
+			if continuation != (op == opContinuation) {
+				return 0, false, a.fail(CloseProtocolError, errProtocol("unexpected opcode "+opName(op)))
+			}
+			if rsv1 && (op == opContinuation || !a.compress) {
+				return 0, false, a.fail(CloseProtocolError, errProtocol("unexpected RSV1 bit"))
+			}
+			a.inMessage, a.final, a.remaining, a.masked, a.pos = true, fin, n, masked, 0
+			return op, rsv1, nil
+		case opClose, opPing, opPong:
+			if !fin || n > maxControlPayload || rsv1 {
+				return 0, false, a.fail(CloseProtocolError, errProtocol("invalid control frame"))
+			}
+			payload := make([]byte, n)
+			if _, err := io.ReadFull(a.br, payload); err != nil {
+				return 0, false, a.readFailed(err)
+			}
+			if masked {
+				maskBytes(a.key, 0, payload)
+			}
+			if err := a.control(op, payload); err != nil {
+				return 0, false, err
+			}
+		default:
+			return 0, false, a.fail(CloseProtocolError, errProtocol("unknown opcode "+opName(op)))
+		}
+	}
+}
+
+// control handles the control frame.
+func (a *Conn) control(op byte, payload []byte) error {
+	switch op {
+	case opPing:
+		if err := a.writeFrame(opPong, true, false, payload); err != nil && err != ErrCloseSent {
+			return a.readFailed(err)
+		}
+	case opPong:
+		if a.onPong != nil {
+			a.onPong(payload)
+		}
+	case opClose:
+		e := &CloseError{Code: CloseNoStatusReceived}
+		echo := []byte(nil)
+		if len(payload) > 0 {
+			if len(payload) < 2 {
+				return a.fail(CloseProtocolError, errProtocol("invalid close payload"))
+			}
+			e.Code = int(binary.BigEndian.Uint16(payload))
+			e.Text = string(payload[2:])
+			if !validCloseCode(e.Code) || !utf8.ValidString(e.Text) {
+				return a.fail(CloseProtocolError, errProtocol("invalid close payload"))
+			}
+			echo = payload[:2]
+		}
+		a.writeFrame(opClose, true, false, echo)
+		a.readErr = e
+		a.closeConn()
+		return e
+	}
+	return nil
+}
+
+// fail sends the close frame of the code, closes the connection, and makes err sticky for reading.
+func (a *Conn) fail(code int, err error) error {
+	a.writeFrame(opClose, true, false, closePayload(code, ""))
+	a.closeConn()
+	if a.readErr == nil {
+		a.readErr = err
+	}
+	return a.readErr
+}
+
+// readFailed makes the read error sticky, the errors except timeouts are regarded as the abnormal closure.
+func (a *Conn) readFailed(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		err = &CloseError{Code: CloseAbnormalClosure, Text: err.Error()}
+	}
+	if a.readErr == nil {
+		a.readErr = err
+	}
+	return a.readErr
+}
+
+func (a *Conn) closeConn() {
+	a.closeOnce.Do(func() {
+		close(a.received)
+		a.conn.Close()
+	})
+}
+
+// frameReader reads the payload of the frames of a message.
+type frameReader struct {
+	conn *Conn
+	seq  int
+}
+
+func (a *frameReader) Read(p []byte) (int, error) {
+	c := a.conn
+	c.readSem <- struct{}{}
+	defer func() { <-c.readSem }()
+
+	if a.seq != c.seq {
+		return 0, io.EOF
+	}
+	for c.remaining == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+		if c.final {
+			c.inMessage = false
+			return 0, io.EOF
+		}
+		if _, _, err := c.nextFrame(true); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.br.Read(p)
+	if c.masked {
+		c.pos = maskBytes(c.key, c.pos, p[:n])
+	}
+	c.remaining -= int64(n)
+	if err != nil {
+		return n, c.readFailed(err)
+	}
+	return n, nil
+}
+
+// limitReader fails the connection with CloseMessageTooBig if the message is larger than n.
+type limitReader struct {
+	conn *Conn
+	r    io.Reader
+	n    int64
+}
+
+func (a *limitReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > a.n+1 {
+		p = p[:a.n+1]
+	}
+	n, err := a.r.Read(p)
+	a.n -= int64(n)
+	if a.n < 0 {
+		return 0, a.conn.fail(CloseMessageTooBig, ErrReadLimit)
+	}
+	return n, err
+}
+
+// WriteMessage writes the data message.
+func (a *Conn) WriteMessage(typ MessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return errInvalidType
+	}
+	if !a.compress {
+		return a.writeFrame(byte(typ), true, false, data)
+	}
+	w, err := a.NextWriter(typ)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// NextWriter returns the writer of the next data message, the message is fragmented into the frames
+// of the written data. The message is compressed if permessage-deflate is negotiated.
+// The writer must be closed to finish the message before writing the next one.
+func (a *Conn) NextWriter(typ MessageType) (io.WriteCloser, error) {
+	if typ != TextMessage && typ != BinaryMessage {
+		return nil, errInvalidType
+	}
+	w := &messageWriter{
+		conn:       a,
+		op:         byte(typ),
+		compressed: a.compress,
+		buf:        make([]byte, 0, writeBufferSize),
+	}
+	if w.compressed {
+		w.fw = newFlateWriter(&truncWriter{w: rawWriter{w}})
+	}
+	return w, nil
+}
+
+// WriteControl writes the control message, the data must not be longer than 125 bytes.
+func (a *Conn) WriteControl(typ MessageType, data []byte) error {
+	if typ != CloseMessage && typ != PingMessage && typ != PongMessage {
+		return errInvalidType
+	}
+	if len(data) > maxControlPayload {
+		return errProtocol("control payload too long")
+	}
+	return a.writeFrame(byte(typ), true, false, data)
+}
+
+// Ping writes the ping message.
+func (a *Conn) Ping(data []byte) error {
+	return a.WriteControl(PingMessage, data)
+}
+
+// Close starts the close handshake with the code and text, waits for the close frame of the peer,
+// and closes the underlying connection. The close frame of the peer is read by Close itself
+// if the connection is not being read by another goroutine.
+func (a *Conn) Close(code int, text string) error {
+	if len(text) > maxControlPayload-2 {
+		text = text[:maxControlPayload-2]
+	}
+	err := a.writeFrame(opClose, true, false, closePayload(code, text))
+	if err == ErrCloseSent {
+		err = nil
+	}
+
+	timer := time.NewTimer(closeTimeout)
+	defer timer.Stop()
+	select {
+	case a.readSem <- struct{}{}:
+		a.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+		for a.discard() == nil {
+			if _, _, err := a.nextFrame(false); err != nil {
+				break
+			}
+		}
+		<-a.readSem
+	case <-a.received:
+	case <-timer.C:
+	}
+	a.closeConn()
+	return err
+}
+
+// writeFrame writes a frame with the payload.
+func (a *Conn) writeFrame(op byte, fin, rsv1 bool, payload []byte) error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	if a.writeErr != nil {
+		return a.writeErr
+	}
+	if a.closeSent {
+		return ErrCloseSent
+	}
+
+	var b [14]byte
+	b[0] = op
+	if fin {
+		b[0] |= 0x80
+	}
+	if rsv1 {
+		b[0] |= 0x40
+	}
+	n := 2
+	switch m := len(payload); {
+	case m < 126:
+		b[1] = byte(m)
+	case m <= 0xffff:
+		b[1] = 126
+		binary.BigEndian.PutUint16(b[2:], uint16(m))
+		n = 4
+	default:
+		b[1] = 127
+		binary.BigEndian.PutUint64(b[2:], uint64(m))
+		n = 10
+	}
+
+	var err error
+	if a.server {
+		a.bw.Write(b[:n])
+		a.bw.Write(payload)
+	} else {
+		b[1] |= 0x80
+		var key [4]byte
+		if _, err = rand.Read(key[:]); err != nil {
+			return err
+		}
+		copy(b[n:], key[:])
+		a.bw.Write(b[:n+4])
+		var chunk [512]byte
+		for pos := 0; pos < len(payload); {
+			k := copy(chunk[:], payload[pos:])
+			pos = maskBytes(key, pos, chunk[:k])
+			a.bw.Write(chunk[:k])
+		}
+	}
+	if err = a.bw.Flush(); err != nil {
+		a.writeErr = err
+		return err
+	}
+	if op == opClose {
+		a.closeSent = true
+	}
+	return nil
+}
+
+// messageWriter writes a message as frames.
+type messageWriter struct {
+	conn       *Conn
+	op         byte
+	compressed bool
+	fw         *flate.Writer
+	buf        []byte
+	closed     bool
+	err        error
+}
+
+func (a *messageWriter) Write(p []byte) (int, error) {
+	if a.closed {
+		return 0, errWriterClosed
+	}
+	if a.compressed {
+		n, err := a.fw.Write(p)
+		if err == nil {
+			err = a.err
+		}
+		return n, err
+	}
+	return a.write(p)
+}
+
+// write buffers the raw frame data, the full buffer is written as a frame.
+func (a *messageWriter) write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if len(a.buf) == cap(a.buf) {
+			if err := a.flush(false); err != nil {
+				return n - len(p), err
+			}
+		}
+		k := copy(a.buf[len(a.buf):cap(a.buf)], p)
+		a.buf = a.buf[:len(a.buf)+k]
+		p = p[k:]
+	}
+	return n, nil
+}
+
+func (a *messageWriter) flush(fin bool) error {
+	if a.err != nil {
+		return a.err
+	}
+	op := a.op
+	a.op = opContinuation
+	a.err = a.conn.writeFrame(op, fin, a.compressed && op != opContinuation, a.buf)
+	a.buf = a.buf[:0]
+	return a.err
+}
+
+// Close finishes the message.
+func (a *messageWriter) Close() error {
+	if a.closed {
+		return errWriterClosed
+	}
+	a.closed = true
+	if a.compressed {
+		err := a.fw.Flush()
+		putFlateWriter(a.fw)
+		if err != nil {
+			return err
+		}
+	}
+	return a.flush(true)
+}
+
+// rawWriter writes the raw frame data of the message writer.
+type rawWriter struct {
+	w *messageWriter
+}
+
+func (a rawWriter) Write(p []byte) (int, error) {
+	return a.w.write(p)
+}
+
+// maskBytes masks b by the key from the position, and returns the next position.
+func maskBytes(key [4]byte, pos int, b []byte) int {
+	for i := range b {
+		b[i] ^= key[(pos+i)&3]
+	}
+	return pos + len(b)
+}
+
+func closePayload(code int, text string) []byte {
+	if code == CloseNoStatusReceived {
+		return nil
+	}
+	b := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(b, uint16(code))
+	copy(b[2:], text)
+	return b
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	default:
+		return code >= 3000 && code <= 4999
+	}
+}
+
+func opName(op byte) string {
+	return strconv.Itoa(int(op))
+}
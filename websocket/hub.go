@@ -0,0 +1,361 @@
+package websocket
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ofunc/ws"
+)
+
+// Hub manages the clients in the named rooms.
+type Hub struct {
+	mu           sync.Mutex
+	clients      map[*Client]struct{}
+	rooms        map[string]map[*Client]struct{}
+	closed       bool
+	queueSize    int
+	writeTimeout time.Duration
+	onJoin       func(room string, c *Client)
+	onLeave      func(room string, c *Client)
+	watchOnce    sync.Once
+}
+
+// NewHub creates a new hub.
+func NewHub() *Hub {
+	return &Hub{
+		clients:      make(map[*Client]struct{}),
+		rooms:        make(map[string]map[*Client]struct{}),
+		queueSize:    64,
+		writeTimeout: 10 * time.Second,
+	}
+}
+
+// QueueSize sets the size of the send queues of the clients registered later, the default is 64.
+// The client is evicted as a slow consumer if its queue is full.
+func (a *Hub) QueueSize(n int) *Hub {
+	a.queueSize = n
+	return a
+}
+
+// WriteTimeout sets the timeout of writing a message to the client, the default is 10 seconds.
+func (a *Hub) WriteTimeout(d time.Duration) *Hub {
+	a.writeTimeout = d
+	return a
+}
+
+// OnJoin sets the callback called after a client joins a room.
+func (a *Hub) OnJoin(fn func(room string, c *Client)) *Hub {
+	a.onJoin = fn
+	return a
+}
+
+// OnLeave sets the callback called after a client leaves a room, including closing the client.
+func (a *Hub) OnLeave(fn func(room string, c *Client)) *Hub {
+	a.onLeave = fn
+	return a
+}
+
+// Register registers the connection, and starts writing its send queue.
+// The connection is closed immediately if the hub is closed.
+func (a *Hub) Register(conn *Conn) *Client {
+	c := &Client{
+		hub:     a,
+		conn:    conn,
+		rooms:   make(map[string]struct{}),
+		send:    make(chan message, a.queueSize),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.write()
+
+	a.mu.Lock()
+	closed := a.closed
+	if !closed {
+		a.clients[c] = struct{}{}
+	}
+	a.mu.Unlock()
+	if closed {
+		c.shutdown(CloseGoingAway, "server shutdown", false)
+	}
+	return c
+}
+
+// Handler returns the handler which upgrades the connection by the upgrader, registers it,
+// and calls fn with the client. The client is closed after fn returns,
+// and all the clients of the hub are closed with CloseGoingAway when the server shuts down.
+// The CloseError returned by fn is regarded as the normal end.
+func (a *Hub) Handler(up *Upgrader, fn func(ctx *ws.Context, c *Client) error) func(*ws.Context) error {
+	return func(ctx *ws.Context) error {
+		conn, err := up.Upgrade(ctx)
+		if err != nil {
+			return err
+		}
+		shutdown := ctx.ShutdownNotify()
+		a.watchOnce.Do(func() {
+			go func() {
+				<-shutdown
+				a.Close()
+			}()
+		})
+
+		c := a.Register(conn)
+		err = fn(ctx, c)
+		if _, ok := err.(*CloseError); ok {
+			err = nil
+		}
+		select {
+		case <-c.closing:
+			// the read error is caused by closing the client.
+			err = nil
+		default:
+		}
+		if err != nil {
+			c.Close(CloseInternalServerErr, "")
+		} else {
+			c.Close(CloseNormalClosure, "")
+		}
+		<-c.done
+		return err
+	}
+}
+
+// Broadcast sends the message to the clients in the room, and returns the number of the queued clients.
+// The slow clients whose queues are full are evicted.
+func (a *Hub) Broadcast(room string, typ MessageType, data []byte) int {
+	n := 0
+	for _, c := range a.Members(room) {
+		if c.Send(typ, data) {
+			n++
+		}
+	}
+	return n
+}
+
+// Members returns the clients in the room.
+func (a *Hub) Members(room string) []*Client {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cs := make([]*Client, 0, len(a.rooms[room]))
+	for c := range a.rooms[room] {
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+// Rooms returns the names of the rooms which have clients.
+func (a *Hub) Rooms() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	names := make([]string, 0, len(a.rooms))
+	for name := range a.rooms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Len returns the number of the clients.
+func (a *Hub) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.clients)
+}
+
+// Close closes all the clients with CloseGoingAway after their queued messages are written,
+// and waits for them. The clients registered later are closed immediately.
+func (a *Hub) Close() {
+	a.mu.Lock()
+	a.closed = true
+	cs := make([]*Client, 0, len(a.clients))
+	for c := range a.clients {
+		cs = append(cs, c)
+	}
+	a.mu.Unlock()
+
+	for _, c := range cs {
+		c.shutdown(CloseGoingAway, "server shutdown", true)
+	}
+	for _, c := range cs {
+		<-c.done
+	}
+}
+
+// remove removes the client from the hub and its rooms, and returns the sorted rooms.
+func (a *Hub) remove(c *Client) []string {
+	a.mu.Lock()
+	delete(a.clients, c)
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+		a.leave(room, c)
+	}
+	a.mu.Unlock()
+	sort.Strings(rooms)
+	return rooms
+}
+
+// leave removes the client from the room, the hub must be locked.
+func (a *Hub) leave(room string, c *Client) {
+	delete(c.rooms, room)
+	if cs := a.rooms[room]; cs != nil {
+		delete(cs, c)
+		if len(cs) == 0 {
+			delete(a.rooms, room)
+		}
+	}
+}
+
+type message struct {
+	typ  MessageType
+	data []byte
+}
+
+// Client is the connection registered in the hub, its messages are written by its own goroutine.
+type Client struct {
+	// Data is the user data, it should be set before joining any room.
+	Data interface{}
+
+	hub     *Hub
+	conn    *Conn
+	rooms   map[string]struct{}
+	send    chan message
+	once    sync.Once
+	closing chan struct{}
+	done    chan struct{}
+	code    int
+	text    string
+	drain   bool
+}
+
+// Conn returns the connection of the client, it should only be read since the messages are written by Send.
+func (a *Client) Conn() *Conn {
+	return a.conn
+}
+
+// Join joins the room, it does nothing if the client is closed or already in the room.
+func (a *Client) Join(room string) {
+	h := a.hub
+	h.mu.Lock()
+	_, registered := h.clients[a]
+	_, joined := a.rooms[room]
+	ok := registered && !joined
+	if ok {
+		a.rooms[room] = struct{}{}
+		cs := h.rooms[room]
+		if cs == nil {
+			cs = make(map[*Client]struct{})
+			h.rooms[room] = cs
+		}
+		cs[a] = struct{}{}
+	}
+	h.mu.Unlock()
+
+	if ok && h.onJoin != nil {
+		h.onJoin(room, a)
+	}
+}
+
+// Leave leaves the room, it does nothing if the client is not in the room.
+func (a *Client) Leave(room string) {
+	h := a.hub
+	h.mu.Lock()
+	_, ok := a.rooms[room]
+	if ok {
+		h.leave(room, a)
+	}
+	h.mu.Unlock()
+
+	if ok && h.onLeave != nil {
+		h.onLeave(room, a)
+	}
+}
+
+// Rooms returns the names of the rooms which the client is in.
+func (a *Client) Rooms() []string {
+	a.hub.mu.Lock()
+	defer a.hub.mu.Unlock()
+	names := make([]string, 0, len(a.rooms))
+	for name := range a.rooms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Send queues the message, and reports whether it is queued.
+// The client is evicted by ClosePolicyViolation if its queue is full.
+func (a *Client) Send(typ MessageType, data []byte) bool {
+	select {
+	case <-a.closing:
+		return false
+	default:
+	}
+	select {
+	case a.send <- message{typ, data}:
+		return true
+	default:
+		a.shutdown(ClosePolicyViolation, "slow consumer", false)
+		return false
+	}
+}
+
+// Close closes the client with the code and text after its queued messages are written.
+// It leaves all the rooms immediately.
+func (a *Client) Close(code int, text string) {
+	a.shutdown(code, text, true)
+}
+
+// Done returns a channel which is closed after the client is closed.
+func (a *Client) Done() <-chan struct{} {
+	return a.done
+}
+
+// shutdown closes the client once, onLeave is called after the Once
+// since it may close the client or send to it again.
+func (a *Client) shutdown(code int, text string, drain bool) {
+	var rooms []string
+	a.once.Do(func() {
+		rooms = a.hub.remove(a)
+		a.code, a.text, a.drain = code, text, drain
+		close(a.closing)
+	})
+	if fn := a.hub.onLeave; fn != nil {
+		for _, room := range rooms {
+			fn(room, a)
+		}
+	}
+}
+
+// write writes the queued messages until the client is closed.
+func (a *Client) write() {
+	defer close(a.done)
+	for {
+		select {
+		case m := <-a.send:
+			if err := a.writeMessage(m); err != nil {
+				a.shutdown(CloseGoingAway, "", false)
+			}
+		case <-a.closing:
+			for a.drain {
+				select {
+				case m := <-a.send:
+					if err := a.writeMessage(m); err != nil {
+						a.drain = false
+					}
+				default:
+					a.drain = false
+				}
+			}
+			a.conn.Close(a.code, a.text)
+			return
+		}
+	}
+}
+
+func (a *Client) writeMessage(m message) error {
+	if d := a.hub.writeTimeout; d > 0 {
+		a.conn.SetWriteDeadline(time.Now().Add(d))
+	}
+	return a.conn.WriteMessage(m.typ, m.data)
+}
@@ -0,0 +1,189 @@
+package websocket
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pipeClient registers the server side of a pipe in the hub, and returns the client side.
+// The pipe is synchronous, so the messages are not written until the peer reads them.
+func pipeClient(h *Hub, data string) (*Client, *Conn) {
+	server, client := net.Pipe()
+	c := h.Register(newConn(server, nil, nil, true))
+	c.Data = data
+	return c, newConn(client, nil, nil, false)
+}
+
+type presence struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (a *presence) add(event string) {
+	a.mu.Lock()
+	a.events = append(a.events, event)
+	a.mu.Unlock()
+}
+
+func (a *presence) get() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.events...)
+}
+
+func waitDone(t *testing.T, c *Client) {
+	t.Helper()
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("client is not closed")
+	}
+}
+
+func TestHubRooms(t *testing.T) {
+	var p presence
+	h := NewHub().OnJoin(func(room string, c *Client) {
+		p.add("join " + room + " " + c.Data.(string))
+	}).OnLeave(func(room string, c *Client) {
+		p.add("leave " + room + " " + c.Data.(string))
+	})
+	a, pa := pipeClient(h, "a")
+	b, pb := pipeClient(h, "b")
+	a.Join("lobby")
+	a.Join("x")
+	a.Join("lobby")
+	b.Join("lobby")
+
+	if rooms := h.Rooms(); !reflect.DeepEqual(rooms, []string{"lobby", "x"}) {
+		t.Errorf("Rooms = %q", rooms)
+	}
+	if n := len(h.Members("lobby")); n != 2 || h.Len() != 2 {
+		t.Errorf("Members = %d, Len = %d", n, h.Len())
+	}
+	if n := h.Broadcast("lobby", TextMessage, []byte("hi")); n != 2 {
+		t.Errorf("Broadcast = %d, want 2", n)
+	}
+	expectMessage(t, pa, TextMessage, []byte("hi"))
+	expectMessage(t, pb, TextMessage, []byte("hi"))
+
+	b.Leave("lobby")
+	b.Leave("lobby")
+	if n := h.Broadcast("lobby", TextMessage, []byte("a only")); n != 1 {
+		t.Errorf("Broadcast = %d, want 1", n)
+	}
+	expectMessage(t, pa, TextMessage, []byte("a only"))
+
+	a.Close(CloseNormalClosure, "bye")
+	if e := expectClose(t, pa, CloseNormalClosure); e.Text != "bye" {
+		t.Errorf("close text = %q", e.Text)
+	}
+	waitDone(t, a)
+	if a.Send(TextMessage, []byte("late")) {
+		t.Error("Send queued to the closed client")
+	}
+	a.Join("y")
+	if rooms := h.Rooms(); len(rooms) != 0 || h.Len() != 1 {
+		t.Errorf("Rooms = %q, Len = %d after closing", rooms, h.Len())
+	}
+
+	want := []string{"join lobby a", "join x a", "join lobby b", "leave lobby b", "leave lobby a", "leave x a"}
+	if got := p.get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+	b.Close(CloseNormalClosure, "")
+	expectClose(t, pb, CloseNormalClosure)
+}
+
+func TestHubEviction(t *testing.T) {
+	left := make(chan string, 1)
+	h := NewHub().QueueSize(1).WriteTimeout(0).OnLeave(func(room string, c *Client) {
+		left <- room
+	})
+	c, peer := pipeClient(h, "slow")
+	c.Join("lobby")
+
+	sent := 0
+	for h.Broadcast("lobby", BinaryMessage, []byte{byte(sent)}) == 1 {
+		sent++
+		if sent > 3 {
+			t.Fatalf("%d messages are queued with the queue size 1", sent)
+		}
+	}
+	select {
+	case room := <-left:
+		if room != "lobby" {
+			t.Errorf("OnLeave room = %q", room)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnLeave is not called for the evicted client")
+	}
+	if h.Len() != 0 || len(h.Members("lobby")) != 0 {
+		t.Errorf("Len = %d after eviction", h.Len())
+	}
+	expectClose(t, peer, ClosePolicyViolation)
+	waitDone(t, c)
+}
+
+func TestHubLeaveCallback(t *testing.T) {
+	var h *Hub
+	h = NewHub().QueueSize(1).WriteTimeout(0).OnLeave(func(room string, c *Client) {
+		// both would deadlock if OnLeave were called while closing the client.
+		c.Send(TextMessage, []byte("gone"))
+		c.Close(CloseGoingAway, "")
+		h.Broadcast(room, TextMessage, []byte(c.Data.(string)+" left"))
+	})
+	a, pa := pipeClient(h, "a")
+	b, pb := pipeClient(h, "b")
+	a.Join("lobby")
+	b.Join("lobby")
+
+	done := make(chan struct{})
+	go func() {
+		a.Close(CloseNormalClosure, "")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close deadlocks with OnLeave")
+	}
+	expectClose(t, pa, CloseNormalClosure)
+	expectMessage(t, pb, TextMessage, []byte("a left"))
+	waitDone(t, a)
+
+	// the eviction of the full queue calls OnLeave too.
+	for b.Send(TextMessage, []byte("x")) {
+	}
+	expectClose(t, pb, ClosePolicyViolation)
+	waitDone(t, b)
+}
+
+func TestHubClose(t *testing.T) {
+	h := NewHub()
+	a, pa := pipeClient(h, "a")
+	a.Join("lobby")
+	a.Send(TextMessage, []byte("queued"))
+
+	closed := make(chan struct{})
+	go func() {
+		h.Close()
+		close(closed)
+	}()
+	expectMessage(t, pa, TextMessage, []byte("queued"))
+	expectClose(t, pa, CloseGoingAway)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close does not return")
+	}
+
+	b, pb := pipeClient(h, "b")
+	expectClose(t, pb, CloseGoingAway)
+	waitDone(t, b)
+	if h.Len() != 0 {
+		t.Errorf("Len = %d after Close", h.Len())
+	}
+}
@@ -0,0 +1,424 @@
+// Package websocket implements the WebSocket protocol (RFC 6455) upgraded from ws.Context,
+// with the permessage-deflate extension (RFC 7692) without context takeover.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ofunc/ws"
+)
+
+// MessageType is the type of the message.
+type MessageType int
+
+// Message types.
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+	CloseMessage  MessageType = 8
+	PingMessage   MessageType = 9
+	PongMessage   MessageType = 10
+)
+
+const (
+	opContinuation = 0
+	opText         = 1
+	opBinary       = 2
+	opClose        = 8
+	opPing         = 9
+	opPong         = 10
+
+	maxControlPayload = 125
+)
+
+// Close codes.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+// DefaultReadLimit is the default max size of the read messages.
+const DefaultReadLimit = 32 << 20
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	timeZero     time.Time
+	aLongTimeAgo = time.Unix(1, 0)
+)
+
+// Errors.
+var (
+	ErrCloseSent = errors.New("ws/websocket: close sent")
+	ErrReadLimit = errors.New("ws/websocket: message too big")
+
+	errInvalidType  = errors.New("ws/websocket: invalid message type")
+	errInvalidUTF8  = errors.New("ws/websocket: invalid UTF-8 text")
+	errWriterClosed = errors.New("ws/websocket: writer closed")
+)
+
+func errProtocol(text string) error {
+	return errors.New("ws/websocket: protocol error: " + text)
+}
+
+func errHandshake(text string) error {
+	return errors.New("ws/websocket: bad handshake: " + text)
+}
+
+// CloseError is the close frame received from the peer,
+// or the abnormal closure if the connection is closed without it.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (a *CloseError) Error() string {
+	s := "ws/websocket: close " + strconv.Itoa(a.Code)
+	if a.Text != "" {
+		s += " " + a.Text
+	}
+	return s
+}
+
+// Upgrader upgrades the HTTP connections to the WebSocket connections.
+type Upgrader struct {
+	// Subprotocols are the supported subprotocols in the preferred order.
+	Subprotocols []string
+	// CheckOrigin checks the Origin header, the default accepts the same origin or no origin.
+	CheckOrigin func(r *http.Request) bool
+	// Compression negotiates permessage-deflate if the client offers it.
+	Compression bool
+	// ReadLimit is the max size of the read messages, the default is DefaultReadLimit.
+	ReadLimit int64
+}
+
+// Upgrade upgrades the connection of the context.
+// It returns a StatusError if the request is not a valid WebSocket handshake.
+func (a *Upgrader) Upgrade(ctx *ws.Context) (*Conn, error) {
+	r := ctx.Request
+	if r.Method != http.MethodGet {
+		return nil, ws.Status(http.StatusMethodNotAllowed, "ws/websocket: method "+r.Method)
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, ws.Status(http.StatusBadRequest, "ws/websocket: not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, ws.Status(http.StatusUpgradeRequired, "ws/websocket: unsupported version").Header("Sec-WebSocket-Version", "13")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return nil, ws.Status(http.StatusBadRequest, "ws/websocket: invalid Sec-WebSocket-Key")
+	}
+	check := a.CheckOrigin
+	if check == nil {
+		check = sameOrigin
+	}
+	if !check(r) {
+		return nil, ws.Status(http.StatusForbidden, "ws/websocket: origin "+r.Header.Get("Origin"))
+	}
+
+	subprotocol := ""
+	offered := headerTokens(r.Header, "Sec-WebSocket-Protocol")
+	for _, p := range a.Subprotocols {
+		if contains(offered, p) {
+			subprotocol = p
+			break
+		}
+	}
+	compress := a.Compression && acceptDeflate(r.Header)
+
+	netConn, brw, err := ctx.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	netConn.SetDeadline(timeZero)
+
+	bw := brw.Writer
+	bw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	bw.WriteString(acceptKey(key))
+	bw.WriteString("\r\n")
+	if subprotocol != "" {
+		bw.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	if compress {
+		bw.WriteString("Sec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover; client_no_context_takeover\r\n")
+	}
+	for k, vs := range ctx.ResponseWriter.Header() {
+		for _, v := range vs {
+			bw.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+	bw.WriteString("\r\n")
+	if err := bw.Flush(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	c := newConn(netConn, brw.Reader, bw, true)
+	c.subprotocol = subprotocol
+	c.compress = compress
+	if a.ReadLimit > 0 {
+		c.readLimit = a.ReadLimit
+	}
+	return c, nil
+}
+
+// Handler returns the handler which upgrades the connection and calls fn with it.
+// The connection is closed normally after fn returns nil, or with CloseInternalServerErr after fn returns an error,
+// and it is closed with CloseGoingAway if the server shuts down.
+// The CloseError returned by fn is regarded as the normal end.
+func (a *Upgrader) Handler(fn func(*Conn) error) func(*ws.Context) error {
+	return func(ctx *ws.Context) error {
+		c, err := a.Upgrade(ctx)
+		if err != nil {
+			return err
+		}
+
+		shutdown, done := ctx.ShutdownNotify(), make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-shutdown:
+				c.Close(CloseGoingAway, "server shutdown")
+			case <-done:
+			}
+		}()
+
+		err = fn(c)
+		if _, ok := err.(*CloseError); ok {
+			err = nil
+		}
+		if err != nil {
+			c.Close(CloseInternalServerErr, "")
+			return err
+		}
+		c.Close(CloseNormalClosure, "")
+		return nil
+	}
+}
+
+// Dialer dials the WebSocket servers.
+type Dialer struct {
+	// Header is the extra header of the handshake request.
+	Header http.Header
+	// Subprotocols are the requested subprotocols.
+	Subprotocols []string
+	// Compression offers permessage-deflate.
+	Compression bool
+	// TLSConfig is the TLS config of the wss URLs.
+	TLSConfig *tls.Config
+	// ReadLimit is the max size of the read messages, the default is DefaultReadLimit.
+	ReadLimit int64
+}
+
+// Dial dials the ws or wss URL by the zero Dialer.
+func Dial(ctx context.Context, rawurl string) (*Conn, *http.Response, error) {
+	return (&Dialer{}).Dial(ctx, rawurl)
+}
+
+// Dial dials the ws or wss URL, the handshake is canceled with the context.
+// The response is returned for inspection, and its body need not be closed.
+func (a *Dialer) Dial(ctx context.Context, rawurl string) (*Conn, *http.Response, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, nil, err
+	}
+	port := "80"
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme, port = "https", "443"
+	default:
+		return nil, nil, errors.New("ws/websocket: unsupported scheme " + u.Scheme)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var d net.Dialer
+	netConn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		netConn.SetDeadline(deadline)
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			netConn.SetDeadline(aLongTimeAgo)
+		case <-done:
+		}
+	}()
+
+	c, resp, err := a.handshake(netConn, u)
+	close(done)
+	<-stopped
+	if err != nil {
+		netConn.Close()
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, resp, err
+	}
+	netConn.SetDeadline(timeZero)
+	return c, resp, nil
+}
+
+func (a *Dialer) handshake(netConn net.Conn, u *url.URL) (*Conn, *http.Response, error) {
+	if u.Scheme == "https" {
+		cfg := a.TLSConfig
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg = cfg.Clone()
+			cfg.ServerName = u.Hostname()
+		}
+		tc := tls.Client(netConn, cfg)
+		if err := tc.Handshake(); err != nil {
+			return nil, nil, err
+		}
+		netConn = tc
+	}
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(b[:])
+
+	header := make(http.Header)
+	for k, vs := range a.Header {
+		header[k] = vs
+	}
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Key", key)
+	header.Set("Sec-WebSocket-Version", "13")
+	if len(a.Subprotocols) > 0 {
+		header.Set("Sec-WebSocket-Protocol", strings.Join(a.Subprotocols, ", "))
+	}
+	if a.Compression {
+		header.Set("Sec-WebSocket-Extensions", deflateOffer)
+	}
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Host:       u.Host,
+	}
+	if err := req.Write(netConn); err != nil {
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, resp, errHandshake("status " + resp.Status)
+	}
+	if !headerContains(resp.Header, "Connection", "upgrade") || !headerContains(resp.Header, "Upgrade", "websocket") {
+		return nil, resp, errHandshake("missing upgrade headers")
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return nil, resp, errHandshake("mismatched Sec-WebSocket-Accept")
+	}
+	subprotocol := resp.Header.Get("Sec-WebSocket-Protocol")
+	if subprotocol != "" && !contains(a.Subprotocols, subprotocol) {
+		return nil, resp, errHandshake("unrequested subprotocol " + subprotocol)
+	}
+	compress, err := agreedDeflate(resp.Header)
+	if err != nil {
+		return nil, resp, err
+	}
+	if compress && !a.Compression {
+		return nil, resp, errHandshake("unrequested extension permessage-deflate")
+	}
+
+	c := newConn(netConn, br, nil, false)
+	c.subprotocol = subprotocol
+	c.compress = compress
+	if a.ReadLimit > 0 {
+		c.readLimit = a.ReadLimit
+	}
+	return c, resp, nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// sameOrigin reports whether the Origin header is absent or the same as the Host.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// headerTokens returns the comma separated tokens of the header.
+func headerTokens(header http.Header, key string) []string {
+	var tokens []string
+	for _, h := range header[http.CanonicalHeaderKey(key)] {
+		for _, t := range strings.Split(h, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return tokens
+}
+
+// headerContains reports whether the header contains the token case-insensitively.
+func headerContains(header http.Header, key, token string) bool {
+	for _, t := range headerTokens(header, key) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
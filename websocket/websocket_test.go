@@ -0,0 +1,272 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ofunc/ws"
+)
+
+// newServer starts a loopback server of s, and returns the ws URL of it.
+func newServer(t *testing.T, s *ws.Server) string {
+	t.Helper()
+	hs := httptest.NewUnstartedServer(s)
+	hs.Config = s.Server()
+	hs.Config.Handler = s
+	hs.Start()
+	t.Cleanup(hs.Close)
+	return "ws" + strings.TrimPrefix(hs.URL, "http")
+}
+
+func echo(c *Conn) error {
+	for {
+		typ, data, err := c.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if err := c.WriteMessage(typ, data); err != nil {
+			return err
+		}
+	}
+}
+
+func dial(t *testing.T, d *Dialer, url string) *Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, _, err := d.Dial(ctx, url)
+	if err != nil {
+		t.Fatalf("Dial(%s) = %v", url, err)
+	}
+	return c
+}
+
+func expectMessage(t *testing.T, c *Conn, typ MessageType, data []byte) {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	gt, gd, err := c.ReadMessage()
+	if err != nil || gt != typ || !bytes.Equal(gd, data) {
+		t.Fatalf("ReadMessage = %d %d bytes %v, want %d %d bytes", gt, len(gd), err, typ, len(data))
+	}
+}
+
+func expectClose(t *testing.T, c *Conn, code int) *CloseError {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := c.ReadMessage()
+		if err == nil {
+			continue
+		}
+		e, ok := err.(*CloseError)
+		if !ok || e.Code != code {
+			t.Fatalf("ReadMessage = %v, want close %d", err, code)
+		}
+		return e
+	}
+}
+
+func TestEcho(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		s := ws.New()
+		s.Get("/", (&Upgrader{Compression: true}).Handler(echo))
+		c := dial(t, &Dialer{Compression: compress}, newServer(t, s))
+		if c.Compressed() != compress {
+			t.Errorf("Compressed = %v, want %v", c.Compressed(), compress)
+		}
+
+		big := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+		for _, m := range []struct {
+			typ  MessageType
+			data []byte
+		}{
+			{TextMessage, []byte("hello")},
+			{BinaryMessage, []byte{0, 1, 2, 0xff}},
+			{TextMessage, []byte{}},
+			{BinaryMessage, big},
+		} {
+			if err := c.WriteMessage(m.typ, m.data); err != nil {
+				t.Fatal(err)
+			}
+			expectMessage(t, c, m.typ, m.data)
+		}
+
+		w, err := c.NextWriter(BinaryMessage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(big); i += 1000 {
+			end := i + 1000
+			if end > len(big) {
+				end = len(big)
+			}
+			if _, err := w.Write(big[i:end]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		expectMessage(t, c, BinaryMessage, big)
+
+		if err := c.Close(CloseNormalClosure, "bye"); err != nil {
+			t.Errorf("Close = %v", err)
+		}
+	}
+}
+
+func TestPing(t *testing.T) {
+	s := ws.New()
+	s.Get("/", (&Upgrader{}).Handler(echo))
+	c := dial(t, &Dialer{}, newServer(t, s))
+	defer c.Close(CloseNormalClosure, "")
+
+	pong := make(chan string, 1)
+	c.OnPong(func(data []byte) {
+		pong <- string(data)
+	})
+	if err := c.Ping([]byte("p")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteMessage(TextMessage, []byte("after")); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, c, TextMessage, []byte("after"))
+	select {
+	case data := <-pong:
+		if data != "p" {
+			t.Errorf("pong = %q", data)
+		}
+	default:
+		t.Error("no pong before the echo")
+	}
+	if err := c.WriteControl(PingMessage, make([]byte, maxControlPayload+1)); err == nil {
+		t.Error("WriteControl accepted the long payload")
+	}
+}
+
+func TestCloseHandshake(t *testing.T) {
+	s := ws.New()
+	s.Get("/normal", (&Upgrader{}).Handler(func(c *Conn) error {
+		return c.Close(CloseGoingAway, "later")
+	}))
+	s.Get("/error", (&Upgrader{}).Handler(func(c *Conn) error {
+		return errors.New("failed")
+	}))
+	s.Get("/peer", (&Upgrader{}).Handler(func(c *Conn) error {
+		_, _, err := c.ReadMessage()
+		if e, ok := err.(*CloseError); !ok || e.Code != CloseNormalClosure || e.Text != "done" {
+			t.Errorf("server ReadMessage = %v, want close 1000 done", err)
+		}
+		return err
+	}))
+	url := newServer(t, s)
+
+	c := dial(t, &Dialer{}, url+"/normal")
+	if e := expectClose(t, c, CloseGoingAway); e.Text != "later" {
+		t.Errorf("close text = %q", e.Text)
+	}
+	if err := c.WriteMessage(TextMessage, []byte("x")); err == nil {
+		t.Error("WriteMessage succeeded after the close")
+	}
+
+	c = dial(t, &Dialer{}, url+"/error")
+	expectClose(t, c, CloseInternalServerErr)
+
+	c = dial(t, &Dialer{}, url+"/peer")
+	if err := c.Close(CloseNormalClosure, "done"); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+	if err := c.Close(CloseNormalClosure, ""); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	got := make(chan error, 1)
+	s := ws.New()
+	s.Get("/", (&Upgrader{ReadLimit: 16}).Handler(func(c *Conn) error {
+		_, _, err := c.ReadMessage()
+		got <- err
+		return err
+	}))
+	c := dial(t, &Dialer{}, newServer(t, s))
+	if err := c.WriteMessage(BinaryMessage, make([]byte, 32)); err != nil {
+		t.Fatal(err)
+	}
+	expectClose(t, c, CloseMessageTooBig)
+	if err := <-got; err != ErrReadLimit {
+		t.Errorf("server ReadMessage = %v, want ErrReadLimit", err)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	s := ws.New()
+	s.Get("/", (&Upgrader{Subprotocols: []string{"v2", "v1"}}).Handler(echo))
+	url := newServer(t, s)
+
+	c, resp, err := (&Dialer{Subprotocols: []string{"v1", "v2"}}).Dial(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Subprotocol() != "v2" || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Dial = %d %q, want 101 v2", resp.StatusCode, c.Subprotocol())
+	}
+	c.Close(CloseNormalClosure, "")
+
+	_, resp, err = (&Dialer{Header: http.Header{"Origin": {"http://example.com"}}}).Dial(context.Background(), url)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Dial with cross origin = %v %v, want 403", resp, err)
+	}
+
+	httpURL := "http" + strings.TrimPrefix(url, "ws")
+	req, _ := http.NewRequest(http.MethodGet, httpURL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired || resp.Header.Get("Sec-WebSocket-Version") != "13" {
+		t.Errorf("bad version = %d %q, want 426 13", resp.StatusCode, resp.Header.Get("Sec-WebSocket-Version"))
+	}
+
+	resp, err = http.Get(httpURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("plain GET = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	s := ws.New()
+	s.Get("/", (&Upgrader{}).Handler(echo))
+	c := dial(t, &Dialer{}, newServer(t, s))
+	if err := c.WriteMessage(TextMessage, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, c, TextMessage, []byte("x"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Shutdown(ctx)
+	}()
+	expectClose(t, c, CloseGoingAway)
+	if err := <-done; err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+}
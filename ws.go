@@ -2,6 +2,8 @@
 package ws
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -20,16 +22,26 @@ var allAllow = strings.Join([]string{
 	http.MethodDelete,
 }, ", ")
 
+var _ context.Context = (*Context)(nil)
+
 var ctxPool = &sync.Pool{
 	New: func() interface{} {
-		return new(Context)
+		ctx := &Context{
+			matches: make([]match, 0, 16),
+		}
+		ctx.response.ctx = ctx
+		return ctx
 	},
 }
 
 // StatusError is the http status error.
+// The text is the internal detail for logging, and the message is public to the client.
 type StatusError struct {
-	code int
-	text string
+	code    int
+	text    string
+	message string
+	cause   error
+	header  http.Header
 }
 
 // Status creates a new http status error.
@@ -45,32 +57,105 @@ func (a *StatusError) Code() int {
 	return a.code
 }
 
-// Error returns the error string.
-func (a *StatusError) Error() string {
-	return "ws: status(" + strconv.Itoa(a.code) + ") " + a.text
+// Message sets the public message responsed to the client.
+func (a *StatusError) Message(message string) *StatusError {
+	a.message = message
+	return a
 }
 
-func finally(w http.ResponseWriter, err error) {
-	if err == nil {
-		return
+// Public returns the public message, which is the status text by default.
+func (a *StatusError) Public() string {
+	if a.message != "" {
+		return a.message
 	}
+	return http.StatusText(a.code)
+}
+
+// Wrap sets the cause of the error.
+func (a *StatusError) Wrap(err error) *StatusError {
+	a.cause = err
+	return a
+}
 
-	code := http.StatusInternalServerError
-	if e, ok := err.(*StatusError); ok {
-		code = e.code
-	} else if os.IsNotExist(err) {
-		code = http.StatusNotFound
-	} else if os.IsPermission(err) {
-		code = http.StatusForbidden
+// Unwrap returns the cause of the error.
+func (a *StatusError) Unwrap() error {
+	return a.cause
+}
+
+// Header adds the response header, such as Retry-After or WWW-Authenticate.
+func (a *StatusError) Header(key, value string) *StatusError {
+	if a.header == nil {
+		a.header = make(http.Header)
 	}
+	a.header.Add(key, value)
+	return a
+}
 
+// Headers returns the response headers.
+func (a *StatusError) Headers() http.Header {
+	return a.header
+}
+
+// Error returns the error string.
+func (a *StatusError) Error() string {
+	s := "ws: status(" + strconv.Itoa(a.code) + ") " + a.text
+	if a.cause != nil {
+		s += ": " + a.cause.Error()
+	}
+	return s
+}
+
+// ErrorCode returns the http status code of the error.
+func ErrorCode(err error) int {
+	var e interface{ Code() int }
+	switch {
+	case errors.As(err, &e):
+		return e.Code()
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case os.IsNotExist(err):
+		return http.StatusNotFound
+	case os.IsPermission(err):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// DefaultErrorHandler logs the server errors, and responses the status text if the response has not been written.
+// The Problem errors are responsed as problem details,
+// and the StatusError errors are responsed with their headers and public messages.
+func DefaultErrorHandler(ctx *Context, err error) {
+	code := ErrorCode(err)
 	if code >= http.StatusInternalServerError {
 		log.Println(err)
 	}
+	if ctx.Written() {
+		return
+	}
+
+	var p *Problem
+	if errors.As(err, &p) {
+		if err := ctx.Problem(p); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
 	text := http.StatusText(code)
+	var e *StatusError
+	if errors.As(err, &e) {
+		header := ctx.ResponseWriter.Header()
+		for k, vs := range e.header {
+			header[k] = append(header[k], vs...)
+		}
+		if text != "" {
+			text = e.Public()
+		}
+	}
 	if text == "" {
 		code = http.StatusTeapot
 		text = http.StatusText(code)
 	}
-	http.Error(w, text, code)
+	http.Error(ctx.ResponseWriter, text, code)
 }
@@ -0,0 +1,61 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStatusError(t *testing.T) {
+	cause := io.ErrUnexpectedEOF
+	e := Status(http.StatusBadRequest, "body").Wrap(cause).Message("invalid body").
+		Header("X-Reason", "eof").Header("X-Reason", "short")
+	wrapped := fmt.Errorf("bind: %w", e)
+
+	if !errors.Is(wrapped, cause) || ErrorCode(wrapped) != http.StatusBadRequest {
+		t.Errorf("errors.Is = %v, ErrorCode = %d", errors.Is(wrapped, cause), ErrorCode(wrapped))
+	}
+	if msg := e.Error(); !strings.Contains(msg, "status(400) body") || !strings.Contains(msg, cause.Error()) {
+		t.Errorf("Error = %q", msg)
+	}
+	if Status(http.StatusNotFound, "").Public() != "Not Found" {
+		t.Error("Public is not the status text by default")
+	}
+
+	s := New()
+	s.Get("/", func(ctx *Context) error {
+		ctx.ResponseWriter.Header().Set("X-Reason", "handler")
+		return wrapped
+	})
+	w := serve(s, http.MethodGet, "/", nil)
+	if w.Code != http.StatusBadRequest || w.Body.String() != "invalid body\n" {
+		t.Errorf("GET / = %d %q, want 400 with the public message", w.Code, w.Body.String())
+	}
+	if got := w.Header()["X-Reason"]; !reflect.DeepEqual(got, []string{"handler", "eof", "short"}) {
+		t.Errorf("X-Reason = %q, want the merged headers", got)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	_, notExist := os.Open("/nonexistent/file")
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{Status(http.StatusConflict, ""), http.StatusConflict},
+		{NewProblem(http.StatusUnprocessableEntity, ""), http.StatusUnprocessableEntity},
+		{notExist, http.StatusNotFound},
+		{os.ErrPermission, http.StatusForbidden},
+		{errors.New("x"), http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		if code := ErrorCode(c.err); code != c.code {
+			t.Errorf("ErrorCode(%v) = %d, want %d", c.err, code, c.code)
+		}
+	}
+}